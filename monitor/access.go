@@ -0,0 +1,19 @@
+//go:build unix
+
+package monitor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// accessWrite is W_OK of access(2).
+const accessWrite = 0x2
+
+// dirWritable reports whether files can be created in dir.
+func dirWritable(dir string) error {
+	if err := syscall.Access(dir, accessWrite); err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package monitor
+
+// dirWritable is a stub, the permissions of dir are only known once a file
+// is created in it.
+func dirWritable(string) error { return nil }
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "<redacted>"
+
+// secretFields are the settings that are never printed.
+var secretFields = map[string]bool{
+	"auth-token":            true,
+	"auth-pass":             true,
+	"telegram-token":        true,
+	"pagerduty-routing-key": true,
+	"influx-token":          true,
+	// webhook URLs carry their token
+	"slack-webhook":   true,
+	"discord-webhook": true,
+	"teams-webhook":   true,
+	"webhook-url":     true,
+}
+
+// WriteConfig writes the effective settings to w as a config file, with
+// the secrets, URL passwords and header values redacted.
+func (c *Config) WriteConfig(w io.Writer) error {
+	doc := make(map[string]any)
+	for key, field := range c.fileFields() {
+		v := reflect.ValueOf(field).Elem().Interface()
+		switch {
+		case secretFields[key]:
+			if !reflect.ValueOf(v).IsZero() {
+				v = redacted
+			}
+		case key == "url":
+			v = redactURLs(c.StatsURLs)
+		case key == "proxy" && c.Proxy != "":
+			v = redactURLs([]string{c.Proxy})[0]
+		case key == "header":
+			v = redactHeaders(c.Headers)
+		}
+		doc[key] = v
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func redactURLs(raw []string) []string {
+	out := make([]string, len(raw))
+	for i, r := range raw {
+		out[i] = r
+		if u, err := url.Parse(r); err == nil {
+			out[i] = u.Redacted()
+		}
+	}
+	return out
+}
+
+func redactHeaders(headers []string) []string {
+	out := make([]string, len(headers))
+	for i, h := range headers {
+		name, _, _ := strings.Cut(h, ":")
+		out[i] = name + ": " + redacted
+	}
+	return out
+}
+
+// notifierNames lists the notifiers the settings enable.
+func (c *Config) notifierNames() []string {
+	names := []string{"log"}
+	for _, n := range []struct {
+		name string
+		on   bool
+	}{
+		{"slack", c.SlackWebhook != ""},
+		{"discord", c.DiscordWebhook != ""},
+		{"teams", c.TeamsWebhook != ""},
+		{"telegram", c.TelegramToken != ""},
+		{"pagerduty", c.PagerDutyKey != ""},
+		{"webhook", c.WebhookURL != ""},
+		{"syslog", c.SyslogAddr != ""},
+	} {
+		if n.on {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+// logBanner logs the main effective settings once at startup.
+func (c *Config) logBanner() {
+	servers := c.StatsURLs
+	if c.Source != "" {
+		servers = stringList{c.Source}
+	}
+	urls, notifiers := strings.Join(redactURLs(servers), ","), strings.Join(c.notifierNames(), ",")
+	// the message carries the settings, the text log prints it bare
+	msg := fmt.Sprintf("Starting monitor: url %s, interval %v, timeout %v, thresholds load %g, mem %g%%, disk %g%%, net %g%%, notifiers %s.",
+		urls, c.PollingInterval, c.HTTPTimeout,
+		c.LoadAverageThreshold, c.MemoryUsageThreshold, c.FreeDiscSpaceThreshold, c.NetworkBandwidthThreshold, notifiers)
+	if c.DryRun {
+		msg += " Dry run, alerts are only printed."
+	}
+	slog.InfoContext(bare(context.Background()), msg,
+		"url", urls,
+		"interval", c.PollingInterval.String(),
+		"timeout", c.HTTPTimeout.String(),
+		"load_threshold", c.LoadAverageThreshold,
+		"mem_threshold", c.MemoryUsageThreshold,
+		"disk_threshold", c.FreeDiscSpaceThreshold,
+		"net_threshold", c.NetworkBandwidthThreshold,
+		"notifiers", notifiers,
+		"dry_run", c.DryRun)
+}
@@ -0,0 +1,49 @@
+package monitor
+
+import "time"
+
+type breakerEvent int
+
+const (
+	breakerNone breakerEvent = iota
+	breakerOpened
+	breakerClosed
+)
+
+// circuitBreaker pauses the polling of a server after consecutive failed
+// fetches. Once the cooldown is over a single test poll is let through,
+// it closes the circuit on success and reopens it on failure.
+type circuitBreaker struct {
+	failures  int
+	open      bool
+	openUntil time.Time
+}
+
+// allow reports whether the server may be polled at now.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	return !b.open || !now.Before(b.openUntil)
+}
+
+// record counts a poll outcome, threshold 0 disables the breaker.
+func (b *circuitBreaker) record(failed bool, threshold int, cooldown time.Duration, now time.Time) breakerEvent {
+	if !failed || threshold == 0 {
+		wasOpen := b.open
+		*b = circuitBreaker{}
+		if wasOpen {
+			return breakerClosed
+		}
+		return breakerNone
+	}
+
+	b.failures++
+	if b.open {
+		b.openUntil = now.Add(cooldown)
+		return breakerNone
+	}
+	if b.failures < threshold {
+		return breakerNone
+	}
+	b.open = true
+	b.openUntil = now.Add(cooldown)
+	return breakerOpened
+}
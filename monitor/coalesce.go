@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// coalescingNotifier buffers the alerts of a server for a window after
+// the first one and sends them to next as one combined alert, so that
+// simultaneous breaches don't flood a chat channel.
+type coalescingNotifier struct {
+	next   Notifier
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[string][]Alert
+	timers  map[string]*time.Timer
+	closed  bool
+	// flushes counts the timers that haven't finished their flush yet
+	flushes sync.WaitGroup
+}
+
+func newCoalescingNotifier(next Notifier, window time.Duration) *coalescingNotifier {
+	return &coalescingNotifier{
+		next:    next,
+		window:  window,
+		pending: make(map[string][]Alert),
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+func (n *coalescingNotifier) Notify(ctx context.Context, a Alert) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return n.next.Notify(ctx, a)
+	}
+	n.pending[a.Server] = append(n.pending[a.Server], a)
+	if _, ok := n.timers[a.Server]; !ok {
+		n.flushes.Add(1)
+		n.timers[a.Server] = time.AfterFunc(n.window, func() {
+			defer n.flushes.Done()
+			n.flush(a.Server)
+		})
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// flush sends the alerts buffered for server. The poll that raised them
+// may be long gone, so it isn't tied to its context.
+func (n *coalescingNotifier) flush(server string) {
+	n.mu.Lock()
+	alerts := n.pending[server]
+	delete(n.pending, server)
+	delete(n.timers, server)
+	n.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	if err := n.next.Notify(context.Background(), combineAlerts(alerts)); err != nil {
+		slog.Error("Unable to send notification.", "notifier", fmt.Sprintf("%T", unwrapNotifier(n.next)), "error", err)
+	}
+}
+
+// Close sends the buffered alerts right away, later ones are no longer
+// buffered. It waits for the flushes of fired timers before closing next.
+func (n *coalescingNotifier) Close() error {
+	n.mu.Lock()
+	n.closed = true
+	servers := make([]string, 0, len(n.timers))
+	for server, t := range n.timers {
+		if t.Stop() {
+			servers = append(servers, server)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, server := range servers {
+		n.flush(server)
+		n.flushes.Done()
+	}
+	n.flushes.Wait()
+	return closeNotifier(n.next)
+}
+
+// combineAlerts merges the alerts of one server, one message per line.
+// It is only a recovery when they all are, the severity is the worst one
+// of the breaches. Value and Threshold are only kept for a single alert.
+func combineAlerts(alerts []Alert) Alert {
+	if len(alerts) == 1 {
+		return alerts[0]
+	}
+
+	c := Alert{Server: alerts[0].Server, Time: alerts[0].Time, Recovered: true}
+	metrics := make([]string, len(alerts))
+	messages := make([]string, len(alerts))
+	for i, a := range alerts {
+		metrics[i], messages[i] = a.Metric, a.Message
+		if a.Recovered {
+			continue
+		}
+		if !c.Recovered && c.Severity == severityCritical {
+			continue
+		}
+		c.Recovered, c.Severity = false, a.Severity
+	}
+	if c.Recovered {
+		c.Severity = alerts[0].Severity
+	}
+	c.Metric = strings.Join(metrics, ",")
+	c.Message = strings.Join(messages, "\n")
+	return c
+}
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowNotifier takes delay to send an alert and reports alerts sent
+// after it was closed.
+type slowNotifier struct {
+	delay time.Duration
+
+	mu     sync.Mutex
+	sent   int
+	closed bool
+	late   int
+}
+
+func (n *slowNotifier) Notify(_ context.Context, _ Alert) error {
+	time.Sleep(n.delay)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent++
+	if n.closed {
+		n.late++
+	}
+	return nil
+}
+
+func (n *slowNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closed = true
+	return nil
+}
+
+func TestCoalescingCloseWaitsForFlush(t *testing.T) {
+	next := &slowNotifier{delay: 100 * time.Millisecond}
+	n := newCoalescingNotifier(next, time.Millisecond)
+	n.Notify(context.Background(), Alert{Server: "a", Metric: metricLoadAverage, Message: "Load Average is too high: 45"})
+	n.Notify(context.Background(), Alert{Server: "a", Metric: metricMemoryUsage, Message: "Memory usage too high: 90%"})
+
+	// the timer has fired and its flush is sending
+	time.Sleep(20 * time.Millisecond)
+	n.Close()
+
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	if next.sent != 1 {
+		t.Errorf("sent %d alerts, want 1 combined", next.sent)
+	}
+	if next.late != 0 {
+		t.Errorf("%d alerts sent after next was closed", next.late)
+	}
+}
+
+func TestCoalescingCloseFlushesPending(t *testing.T) {
+	next := &slowNotifier{}
+	n := newCoalescingNotifier(next, time.Hour)
+	n.Notify(context.Background(), Alert{Server: "a", Metric: metricLoadAverage, Message: "Load Average is too high: 45"})
+	n.Notify(context.Background(), Alert{Server: "b", Metric: metricLoadAverage, Message: "Load Average is too high: 45"})
+	n.Close()
+
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	if next.sent != 2 || next.late != 0 {
+		t.Errorf("sent %d alerts, %d after close, want 2 before close", next.sent, next.late)
+	}
+}
@@ -0,0 +1,1252 @@
+package monitor
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// env fallbacks for secrets kept out of the command line
+const (
+	authTokenEnv      = "STATS_TOKEN"
+	telegramTokenEnv  = "TELEGRAM_TOKEN"
+	telegramChatIDEnv = "TELEGRAM_CHAT_ID"
+	pagerDutyKeyEnv   = "PAGERDUTY_ROUTING_KEY"
+	influxTokenEnv    = "INFLUX_TOKEN"
+)
+
+// Config holds the monitor settings.
+type Config struct {
+	// Version is set by -version, LoadConfig then returns without
+	// reading the config file or validating the settings
+	Version     bool
+	PrintConfig bool
+	Banner      bool
+	ConfigFile  string
+	Once        bool
+	Count       int
+	CountMode   string
+	DryRun      bool
+	NoSummary   bool
+
+	StatsURLs       stringList
+	Failover        bool
+	Source          string
+	PollingInterval time.Duration
+	Jitter          percentage
+	Adaptive        bool
+	AdaptiveMin     time.Duration
+	AdaptiveMax     time.Duration
+	AdaptiveStep    time.Duration
+	HTTPTimeout     time.Duration
+	RetryAttempts   int
+	RetryBackoff    time.Duration
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	MaxFailures     int
+	Format          string
+	StrictFields    bool
+	CSVLine         string
+	ShutdownTimeout time.Duration
+
+	AuthToken string
+	AuthUser  string
+	AuthPass  string
+	Headers   stringList
+	Method    string
+	Body      string
+	BodyFile  string
+
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	AllowInsecureAuth  bool
+	Proxy              string
+	MaxRedirects       int
+	Resolve            stringList
+
+	AlertCooldown    time.Duration
+	NotifyRecovery   bool
+	HysteresisBand   float64
+	Inclusive        bool
+	BreachCount      int
+	BreachRate       stringList
+	SmoothWindow     int
+	DiskETAWarn      time.Duration
+	Maintenance      []MaintenanceWindow
+	MaintenanceUntil string
+	QuietHours       stringList
+	QuietTZ          string
+	StateFile        string
+	Precision        int
+	Units            string
+
+	MetricsAddr  string
+	HealthAddr   string
+	StatsdAddr   string
+	StatsdPrefix string
+
+	GraphiteAddr   string
+	GraphitePrefix string
+	InfluxURL      string
+	InfluxToken    string
+	InfluxOrg      string
+	InfluxBucket   string
+	OTLPEndpoint   string
+	OTLPInsecure   bool
+	LogFormat      string
+	LogLevel       string
+	LogOutput      string
+
+	LogFile       string
+	LogMaxSize    int
+	LogMaxBackups int
+	LogEcho       bool
+	Timestamps    bool
+	TZ            string
+	Color         string
+
+	SlackWebhook    string
+	DiscordWebhook  string
+	TeamsWebhook    string
+	TelegramToken   string
+	TelegramChatID  string
+	PagerDutyKey    string
+	WebhookURL      string
+	WebhookTemplate string
+
+	// files the secrets are read from, see readSecrets
+	AuthTokenFile      string
+	AuthPassFile       string
+	TelegramTokenFile  string
+	PagerDutyKeyFile   string
+	InfluxTokenFile    string
+	SlackWebhookFile   string
+	DiscordWebhookFile string
+	TeamsWebhookFile   string
+
+	CoalesceWindow  time.Duration
+	NotifyRetries   int
+	NotifyBackoff   time.Duration
+	NotifyQueueSize int
+	DeadLetterFile  string
+	NotifyWorkers   int
+	NotifyBuffer    int
+	NotifyBlock     time.Duration
+	SyslogAddr      string
+	SyslogNetwork   string
+	Escalate        stringList
+
+	LoadAverageThreshold      float64
+	MemoryUsageThreshold      float64
+	FreeDiscSpaceThreshold    float64
+	NetworkBandwidthThreshold float64
+
+	LoadMode string
+	CPUCores int
+
+	EnableLoad    bool
+	EnableMemory  bool
+	EnableDisk    bool
+	EnableNetwork bool
+
+	// memory leak detection
+	EnableLeak bool
+	LeakPolls  int
+	LeakDelta  float64
+
+	// network usage spike detection, 0 disables it
+	NetSpike float64
+
+	// fetch latency warning, 0 disables it
+	LatencyWarn time.Duration
+
+	// per-metric evaluation intervals, 0 evaluates on every poll. One
+	// fetch returns every metric, so the stats are still fetched every
+	// interval, the gauges and exports get all of them and only the
+	// alerts of a metric are evaluated less often
+	LoadInterval    time.Duration
+	MemoryInterval  time.Duration
+	DiskInterval    time.Duration
+	NetworkInterval time.Duration
+
+	// composite health score, see healthScore
+	HealthFloor   float64
+	WeightLoad    float64
+	WeightMemory  float64
+	WeightDisk    float64
+	WeightNetwork float64
+
+	// absolute free space minimums in bytes, 0 disables them
+	MemoryFreeMin byteSize
+	DiskFreeMin   byteSize
+
+	// warning thresholds, 0 disables them
+	LoadAverageWarn      float64
+	MemoryUsageWarn      float64
+	FreeDiscSpaceWarn    float64
+	NetworkBandwidthWarn float64
+}
+
+// DefaultConfig returns the settings used when neither a flag nor the
+// config file sets them.
+func DefaultConfig() Config {
+	return Config{
+		CountMode:       countTotal,
+		StatsURLs:       stringList{statsURL},
+		PollingInterval: pollingInterval,
+		AdaptiveMin:     adaptiveMin,
+		AdaptiveMax:     adaptiveMax,
+		AdaptiveStep:    adaptiveStep,
+		HTTPTimeout:     httpTimeout,
+		RetryAttempts:   retryAttempts,
+		RetryBackoff:    retryBackoff,
+		BreakerCooldown: breakerCooldown,
+		Format:          formatAuto,
+		StrictFields:    true,
+		CSVLine:         csvLineFirst,
+		ShutdownTimeout: shutdownTimeout,
+		Method:          http.MethodGet,
+		MaxRedirects:    maxRedirects,
+
+		MetricsAddr:  metricsAddr,
+		StatsdPrefix: statsdPrefix,
+
+		GraphitePrefix: graphitePrefix,
+		LogFormat:      logFormatText,
+		LogOutput:      logOutputStdout,
+		LogLevel:       "info",
+		Units:          unitsMb,
+		TZ:             "Local",
+		QuietTZ:        "Local",
+		Color:          colorAuto,
+
+		LogMaxSize:    logMaxSize,
+		LogMaxBackups: logMaxBackups,
+		LogEcho:       true,
+
+		WebhookTemplate: defaultWebhookTemplate,
+		SyslogNetwork:   syslogNetwork,
+		NotifyBackoff:   notifyBackoff,
+		NotifyQueueSize: notifyQueueSize,
+		NotifyBuffer:    notifyBuffer,
+		NotifyBlock:     notifyBlock,
+
+		HysteresisBand: hysteresisBand,
+		BreachCount:    1,
+		SmoothWindow:   1,
+
+		LoadAverageThreshold:      loadAverageThreshold,
+		MemoryUsageThreshold:      memoryUsageThreshold,
+		FreeDiscSpaceThreshold:    freeDiscSpaceThreshold,
+		NetworkBandwidthThreshold: networkBandwidthThreshold,
+		LoadMode:                  loadModeAbsolute,
+		EnableLoad:                true,
+		EnableMemory:              true,
+		EnableDisk:                true,
+		EnableNetwork:             true,
+		LeakPolls:                 leakPolls,
+		LeakDelta:                 leakDelta,
+		WeightLoad:                1,
+		WeightMemory:              1,
+		WeightDisk:                1,
+		WeightNetwork:             1,
+	}
+}
+
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	fs.BoolVar(&cfg.Version, "version", cfg.Version, "print the version, git commit, build date and Go version and exit")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", cfg.PrintConfig, "print the effective settings as a config file, secrets redacted, and exit")
+	fs.BoolVar(&cfg.Banner, "banner", cfg.Banner, "log the effective url, interval, timeout, thresholds and notifiers at startup")
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "path to YAML config file, the $"+envPrefix+"* variables and flags override its values")
+
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "print the alerts instead of sending them to the external notifiers")
+	fs.BoolVar(&cfg.NoSummary, "no-summary", cfg.NoSummary, "do not log the poll and breach counts on shutdown or after a -once poll")
+	fs.IntVar(&cfg.Count, "count", cfg.Count, "exit after this many polls of every server with the -once exit codes of the last ones, 0 polls until stopped")
+	fs.StringVar(&cfg.CountMode, "count-mode", cfg.CountMode, "polls counted toward -count: total or successful, which skips failed fetches and unparsable stats")
+	fs.BoolVar(&cfg.Once, "once", cfg.Once, "poll once and exit: 0 if healthy, 1 if a critical threshold is breached, 2 if the stats could not be fetched or parsed")
+
+	fs.StringVar(&cfg.Source, "source", cfg.Source, "read the stats from a file:///path, re-read on every poll, or - for stdin instead of the url")
+	fs.Var(&listFlag{list: &cfg.StatsURLs}, "url", "stats endpoint URL, repeat to monitor several servers")
+	fs.BoolVar(&cfg.Failover, "failover", cfg.Failover, "treat the url values as endpoints of one server, tried in order until one answers")
+	fs.DurationVar(&cfg.PollingInterval, "interval", cfg.PollingInterval, "stats polling interval")
+	fs.BoolVar(&cfg.Adaptive, "adaptive", cfg.Adaptive, "poll more often while a server is unhealthy and less often while it is healthy, starting from the interval")
+	fs.DurationVar(&cfg.AdaptiveMin, "adaptive-min", cfg.AdaptiveMin, "shortest adaptive polling interval")
+	fs.DurationVar(&cfg.AdaptiveMax, "adaptive-max", cfg.AdaptiveMax, "longest adaptive polling interval")
+	fs.DurationVar(&cfg.AdaptiveStep, "adaptive-step", cfg.AdaptiveStep, "adaptive polling interval change after every poll")
+	fs.Var(&cfg.Jitter, "jitter", "randomize every poll interval by up to this percentage, e.g. 20%")
+	fs.DurationVar(&cfg.HTTPTimeout, "timeout", cfg.HTTPTimeout, "stats request timeout")
+	fs.StringVar(&cfg.AuthToken, "auth-token", cfg.AuthToken, "bearer token for the stats endpoint, $"+authTokenEnv+" overrides it")
+	fs.StringVar(&cfg.AuthUser, "auth-user", cfg.AuthUser, "basic auth user for the stats endpoint")
+	fs.StringVar(&cfg.AuthPass, "auth-pass", cfg.AuthPass, "basic auth password for the stats endpoint")
+	fs.BoolVar(&cfg.AllowInsecureAuth, "allow-insecure-auth", cfg.AllowInsecureAuth, "send the auth token, basic auth or an Authorization header to http:// URLs, in the clear, with a warning instead of refusing to start")
+	fs.Var(&listFlag{list: &cfg.Headers}, "header", `custom "Name: Value" header for the stats request, repeatable`)
+	fs.StringVar(&cfg.Method, "method", cfg.Method, "stats request method: GET, POST, PUT or PATCH")
+	fs.StringVar(&cfg.Body, "body", cfg.Body, "stats request body for POST, PUT or PATCH, sent as application/json when it is valid JSON and no Content-Type header is set")
+	fs.StringVar(&cfg.BodyFile, "body-file", cfg.BodyFile, "file with the stats request body, read on every poll, see -body")
+	fs.StringVar(&cfg.CAFile, "ca-file", cfg.CAFile, "PEM bundle of root CAs trusted for the stats endpoint")
+	fs.StringVar(&cfg.CertFile, "cert-file", cfg.CertFile, "PEM client certificate for mutual TLS")
+	fs.StringVar(&cfg.KeyFile, "key-file", cfg.KeyFile, "PEM client key for mutual TLS")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "insecure-skip-verify", cfg.InsecureSkipVerify, "do not verify the stats endpoint certificate, for lab use only")
+	fs.IntVar(&cfg.MaxRedirects, "max-redirects", cfg.MaxRedirects, "redirects a stats request may follow, 0 fails the poll on a 3xx response")
+	fs.Var(&listFlag{list: &cfg.Resolve}, "resolve", "host:ip or host:port:ip, connect to ip instead of resolving host like curl --resolve, TLS and the Host header still use host, repeatable")
+	fs.StringVar(&cfg.Proxy, "proxy", cfg.Proxy, "proxy URL for stats requests, overrides HTTP_PROXY, HTTPS_PROXY and NO_PROXY which are used when empty")
+	fs.IntVar(&cfg.RetryAttempts, "retry-attempts", cfg.RetryAttempts, "max stats request attempts per poll, connection errors, 5xx and 429 responses are retried unless they carry a Retry-After delay")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", cfg.RetryBackoff, "delay before the first retry, doubled on every next one")
+	fs.IntVar(&cfg.BreakerFailures, "breaker-failures", cfg.BreakerFailures, "consecutive failed fetches that pause polling of a server for the breaker cooldown, 0 disables the breaker")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", cfg.BreakerCooldown, "how long polling of an unavailable server is paused before a single test poll")
+	fs.IntVar(&cfg.MaxFailures, "max-consecutive-failures", cfg.MaxFailures, "exit with code 2 once a server fails more than this many polls in a row, 0 never gives up")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "max time to wait for active polls on shutdown")
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "stats body format: csv, json, auto to detect it from the body or the name of a registered parser")
+	fs.StringVar(&cfg.CSVLine, "csv-line", cfg.CSVLine, "data line of a multi-line CSV body to use: first or last, blank, # comment and header lines are skipped")
+	fs.BoolVar(&cfg.StrictFields, "strict-fields", cfg.StrictFields, "reject CSV stats with more fields than expected, otherwise extra trailing fields are ignored")
+
+	fs.DurationVar(&cfg.AlertCooldown, "alert-cooldown", cfg.AlertCooldown, "suppress repeated alerts for a metric until the breach clears or this period elapses, 0 disables suppression")
+
+	fs.BoolVar(&cfg.Inclusive, "inclusive", cfg.Inclusive, "breach a threshold at a value equal to it, by default the value has to be strictly over it")
+	fs.Float64Var(&cfg.HysteresisBand, "hysteresis", cfg.HysteresisBand, "how far under its threshold a breached metric must drop to recover, in the metric units (percentage points for usage)")
+	fs.IntVar(&cfg.BreachCount, "breach-count", cfg.BreachCount, "consecutive polls a metric must be over its threshold to alert, or back under it to recover")
+	fs.Var(&listFlag{list: &cfg.BreachRate}, "breach-rate", "K/W or metric=K/W, e.g. memory_usage=3/5, alert when a metric was over its threshold in at least K of the last W polls instead of -breach-count in a row, recover after K polls in a row back under it, repeatable")
+	fs.IntVar(&cfg.SmoothWindow, "smooth-window", cfg.SmoothWindow, "evaluate thresholds against the moving average of the last N samples, this delays alerts by up to N intervals")
+	fs.DurationVar(&cfg.DiskETAWarn, "disk-eta-warn", cfg.DiskETAWarn, "alert when the disk is projected to fill up within this time, 0 disables")
+	fs.IntVar(&cfg.Precision, "precision", cfg.Precision, "decimals of the percentages and Mbit/s in alert messages")
+	fs.StringVar(&cfg.Units, "units", cfg.Units, "byte units of alert messages: mb for whole Mb, binary for KiB/MiB/GiB/TiB or si for kB/MB/GB/TB")
+	fs.StringVar(&cfg.StateFile, "state-file", cfg.StateFile, "JSON file keeping the breached metrics across restarts")
+	fs.Var(&listFlag{list: &cfg.QuietHours}, "quiet-hours", "daily HH:MM-HH:MM window, e.g. 22:00-07:00, when warnings are only logged and not sent to the external notifiers, repeatable")
+	fs.StringVar(&cfg.QuietTZ, "quiet-tz", cfg.QuietTZ, "time zone of the quiet hours, e.g. UTC or Europe/Moscow")
+	fs.StringVar(&cfg.MaintenanceUntil, "maintenance-until", cfg.MaintenanceUntil, "RFC 3339 time until which alerts are logged as suppressed instead of sent")
+	fs.BoolVar(&cfg.NotifyRecovery, "notify-recovery", cfg.NotifyRecovery, "notify when a breached metric returns under its threshold")
+
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "listen address for the Prometheus /metrics endpoint, empty to disable")
+
+	fs.StringVar(&cfg.HealthAddr, "health-addr", cfg.HealthAddr, "listen address for the /healthz liveness endpoint and the /ready one, ready once a poll succeeded within twice the time between polls, empty to disable")
+	fs.StringVar(&cfg.StatsdAddr, "statsd-addr", cfg.StatsdAddr, "StatsD host:port to send the gauges to over UDP after every successful poll")
+	fs.StringVar(&cfg.StatsdPrefix, "statsd-prefix", cfg.StatsdPrefix, "StatsD metric name prefix")
+	fs.StringVar(&cfg.GraphiteAddr, "graphite-addr", cfg.GraphiteAddr, "Graphite carbon host:port to send the gauges and health score to over TCP after every successful poll")
+	fs.StringVar(&cfg.GraphitePrefix, "graphite-prefix", cfg.GraphitePrefix, "Graphite metric path prefix")
+	fs.StringVar(&cfg.InfluxURL, "influx-url", cfg.InfluxURL, "InfluxDB v2 URL to write the stats of every successful poll to")
+	fs.StringVar(&cfg.InfluxToken, "influx-token", cfg.InfluxToken, "InfluxDB API token, $"+influxTokenEnv+" overrides it")
+	fs.StringVar(&cfg.InfluxOrg, "influx-org", cfg.InfluxOrg, "InfluxDB organization")
+	fs.StringVar(&cfg.InfluxBucket, "influx-bucket", cfg.InfluxBucket, "InfluxDB bucket")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", cfg.OTLPEndpoint, "OTLP/gRPC host:port to export the stats to as OpenTelemetry metrics")
+	fs.BoolVar(&cfg.OTLPInsecure, "otlp-insecure", cfg.OTLPInsecure, "export to the OTLP endpoint without TLS")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format: text or json")
+	fs.StringVar(&cfg.LogOutput, "log-output", cfg.LogOutput, "log destination: stdout, or journald to write to the systemd journal with the priority and alert fields on Linux, falling back to stdout elsewhere")
+	fs.BoolVar(&cfg.Timestamps, "timestamps", cfg.Timestamps, "prefix text log lines with an RFC 3339 timestamp, json logs always have one")
+	fs.StringVar(&cfg.Color, "color", cfg.Color, "color text logs by level: auto to color only on a terminal, always or never")
+	fs.StringVar(&cfg.TZ, "tz", cfg.TZ, "time zone of log timestamps, e.g. UTC or Europe/Moscow")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFile, "log-file", cfg.LogFile, "also write logs to this file, rotated by size")
+	fs.IntVar(&cfg.LogMaxSize, "log-max-size", cfg.LogMaxSize, "max log file size in megabytes before rotation")
+	fs.IntVar(&cfg.LogMaxBackups, "log-max-backups", cfg.LogMaxBackups, "number of rotated log files to keep, 0 keeps all")
+	fs.BoolVar(&cfg.LogEcho, "log-echo", cfg.LogEcho, "echo logs to stdout when -log-file is set")
+
+	fs.StringVar(&cfg.SlackWebhook, "slack-webhook", cfg.SlackWebhook, "Slack incoming webhook URL for alerts")
+	fs.StringVar(&cfg.DiscordWebhook, "discord-webhook", cfg.DiscordWebhook, "Discord webhook URL for alerts")
+	fs.StringVar(&cfg.TeamsWebhook, "teams-webhook", cfg.TeamsWebhook, "Microsoft Teams incoming webhook URL for alerts")
+	fs.StringVar(&cfg.TelegramToken, "telegram-token", cfg.TelegramToken, "Telegram bot token for alerts, $"+telegramTokenEnv+" overrides it")
+	fs.StringVar(&cfg.PagerDutyKey, "pagerduty-routing-key", cfg.PagerDutyKey, "PagerDuty Events API v2 routing key, breaches trigger incidents and recoveries resolve them, $"+pagerDutyKeyEnv+" overrides it")
+	fs.StringVar(&cfg.TelegramChatID, "telegram-chat-id", cfg.TelegramChatID, "Telegram chat to send alerts to, defaults to $"+telegramChatIDEnv)
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", cfg.WebhookURL, "generic webhook URL for alerts")
+	fs.StringVar(&cfg.WebhookTemplate, "webhook-template", cfg.WebhookTemplate, "text/template for the webhook JSON payload, rendered against the alert")
+	fs.DurationVar(&cfg.CoalesceWindow, "coalesce", cfg.CoalesceWindow, "buffer the alerts of a server for this long and send them to the external notifiers as one, except PagerDuty, 0 sends each one right away")
+	fs.IntVar(&cfg.NotifyRetries, "notify-retries", cfg.NotifyRetries, "retry a failed notification this many times with exponential backoff, 0 disables retries")
+	fs.DurationVar(&cfg.NotifyBackoff, "notify-backoff", cfg.NotifyBackoff, "delay before the first notification retry, doubled after every failed one")
+	fs.IntVar(&cfg.NotifyQueueSize, "notify-queue-size", cfg.NotifyQueueSize, "max notifications queued for retry per notifier, the oldest is dropped when it is full")
+	fs.StringVar(&cfg.DeadLetterFile, "deadletter-file", cfg.DeadLetterFile, "append the notifications that could not be sent to this file as JSON lines")
+	fs.IntVar(&cfg.NotifyWorkers, "notify-workers", cfg.NotifyWorkers, "send the notifications on this many background workers, each notifier in order on its own one while there are enough, 0 sends them inline from the polls")
+	fs.IntVar(&cfg.NotifyBuffer, "notify-buffer", cfg.NotifyBuffer, "notifications a background worker queues before -notify-block applies")
+	fs.DurationVar(&cfg.NotifyBlock, "notify-block", cfg.NotifyBlock, "how long a poll waits for room in a full worker queue before the notification is dropped")
+	fs.StringVar(&cfg.SyslogAddr, "syslog-addr", cfg.SyslogAddr, "syslog host:port to send alerts to, critical ones at the crit level and warnings at warning")
+	fs.StringVar(&cfg.SyslogNetwork, "syslog-network", cfg.SyslogNetwork, "syslog transport: udp or tcp")
+	fs.Var(&listFlag{list: &cfg.Escalate}, "escalate", "severity:delay:notifier, e.g. critical:15m:pagerduty, sends a breach of that severity still active after the delay to the notifier, which then only gets escalations and their recoveries, repeatable")
+
+	for _, s := range cfg.secrets() {
+		overrides := "-" + s.name
+		if s.env != "" {
+			overrides += " and $" + s.env
+		}
+		fs.StringVar(s.file, s.name+"-file", *s.file, "read "+s.name+" from this file, trailing newlines trimmed, it overrides "+overrides)
+	}
+
+	fs.Float64Var(&cfg.LoadAverageThreshold, "load-threshold", cfg.LoadAverageThreshold, "load average alert threshold")
+	fs.Float64Var(&cfg.MemoryUsageThreshold, "mem-threshold", cfg.MemoryUsageThreshold, "memory usage alert threshold, %")
+	fs.Float64Var(&cfg.FreeDiscSpaceThreshold, "disk-threshold", cfg.FreeDiscSpaceThreshold, "disk usage alert threshold, %")
+	fs.Float64Var(&cfg.NetworkBandwidthThreshold, "net-threshold", cfg.NetworkBandwidthThreshold, "network bandwidth usage alert threshold, %")
+	fs.BoolVar(&cfg.EnableLoad, "enable-load", cfg.EnableLoad, "alert on load average")
+	fs.BoolVar(&cfg.EnableMemory, "enable-mem", cfg.EnableMemory, "alert on memory usage")
+	fs.BoolVar(&cfg.EnableDisk, "enable-disk", cfg.EnableDisk, "alert on disk usage and fill projection")
+	fs.BoolVar(&cfg.EnableNetwork, "enable-net", cfg.EnableNetwork, "alert on network bandwidth usage")
+	fs.DurationVar(&cfg.LoadInterval, "load-interval", cfg.LoadInterval, "evaluate the load average alerts only this often instead of on every poll, at least the interval, 0 on every poll")
+	fs.DurationVar(&cfg.MemoryInterval, "mem-interval", cfg.MemoryInterval, "evaluate the memory usage, free memory and leak alerts only this often instead of on every poll, at least the interval, 0 on every poll")
+	fs.DurationVar(&cfg.DiskInterval, "disk-interval", cfg.DiskInterval, "evaluate the disk usage, free space and fill projection alerts only this often instead of on every poll, at least the interval, 0 on every poll")
+	fs.DurationVar(&cfg.NetworkInterval, "net-interval", cfg.NetworkInterval, "evaluate the network usage and spike alerts only this often instead of on every poll, at least the interval, 0 on every poll")
+	fs.BoolVar(&cfg.EnableLeak, "enable-leak", cfg.EnableLeak, "warn on a suspected memory leak, memory usage growing over consecutive polls")
+	fs.IntVar(&cfg.LeakPolls, "leak-polls", cfg.LeakPolls, "consecutive polls memory usage must not drop in to be a suspected leak")
+	fs.Float64Var(&cfg.LeakDelta, "leak-delta", cfg.LeakDelta, "memory usage growth over the leak polls that is a suspected leak, percentage points")
+	fs.Var(&cfg.MemoryFreeMin, "mem-free-min", "alert when less memory than this is free, in bytes with an optional suffix like 512Mi or 2G, 0 disables it")
+	fs.Var(&cfg.DiskFreeMin, "disk-free-min", "alert when less disk space than this is free, in bytes with an optional suffix like 10Gi or 50G, 0 disables it")
+	fs.DurationVar(&cfg.LatencyWarn, "latency-warn", cfg.LatencyWarn, "warn when fetching the stats of a server takes longer than this, retries included, 0 disables it")
+	fs.Float64Var(&cfg.NetSpike, "net-spike", cfg.NetSpike, "warn when the used network bandwidth grows by more than this percentage between consecutive polls, 0 disables it")
+	fs.Float64Var(&cfg.HealthFloor, "health-floor", cfg.HealthFloor, "alert when the 0-100 health score drops below this, 0 disables it")
+	fs.Float64Var(&cfg.WeightLoad, "weight-load", cfg.WeightLoad, "weight of the load average in the health score, 0 leaves it out")
+	fs.Float64Var(&cfg.WeightMemory, "weight-mem", cfg.WeightMemory, "weight of the memory usage in the health score, 0 leaves it out")
+	fs.Float64Var(&cfg.WeightDisk, "weight-disk", cfg.WeightDisk, "weight of the disk usage in the health score, 0 leaves it out")
+	fs.Float64Var(&cfg.WeightNetwork, "weight-net", cfg.WeightNetwork, "weight of the network bandwidth usage in the health score, 0 leaves it out")
+	fs.StringVar(&cfg.LoadMode, "load-mode", cfg.LoadMode, "load thresholds mode: absolute, or per-core to multiply them by the CPU core count")
+	fs.IntVar(&cfg.CPUCores, "cpu-cores", cfg.CPUCores, "CPU core count for per-core load thresholds, used when the stats have none")
+	fs.Float64Var(&cfg.LoadAverageWarn, "load-warn", cfg.LoadAverageWarn, "load average warning threshold, 0 disables it")
+	fs.Float64Var(&cfg.MemoryUsageWarn, "mem-warn", cfg.MemoryUsageWarn, "memory usage warning threshold, %, 0 disables it")
+	fs.Float64Var(&cfg.FreeDiscSpaceWarn, "disk-warn", cfg.FreeDiscSpaceWarn, "disk usage warning threshold, %, 0 disables it")
+	fs.Float64Var(&cfg.NetworkBandwidthWarn, "net-warn", cfg.NetworkBandwidthWarn, "network bandwidth usage warning threshold, %, 0 disables it")
+
+	return fs
+}
+
+// LoadConfig builds the configuration from the command line args, the
+// config file they name, the MONITOR_* environment variables and the
+// secret environment variables. Flags win over the environment, which
+// wins over the config file.
+func LoadConfig(args []string) (*Config, error) {
+	// -version doesn't depend on the environment, so it is checked on the
+	// flags alone
+	cfg := DefaultConfig()
+	if err := newFlagSet(&cfg).Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+	if cfg.Version {
+		return &cfg, nil
+	}
+
+	// flags are parsed on top of the env values to find the config file,
+	// then again on top of the file and env values so that flags win
+	cfg = DefaultConfig()
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := newFlagSet(&cfg).Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+
+	if cfg.ConfigFile != "" {
+		path := cfg.ConfigFile
+		cfg = DefaultConfig()
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+		if err := cfg.loadEnv(); err != nil {
+			return nil, err
+		}
+		if err := newFlagSet(&cfg).Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUsage, err)
+		}
+	}
+
+	if err := cfg.readSecrets(); err != nil {
+		return nil, err
+	}
+	if cfg.TelegramChatID == "" {
+		cfg.TelegramChatID = os.Getenv(telegramChatIDEnv)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// fileFields maps YAML keys to the config fields they set.
+func (c *Config) fileFields() map[string]any {
+	fields := map[string]any{
+		"url":                      &c.StatsURLs,
+		"failover":                 &c.Failover,
+		"banner":                   &c.Banner,
+		"source":                   &c.Source,
+		"interval":                 &c.PollingInterval,
+		"adaptive":                 &c.Adaptive,
+		"adaptive-min":             &c.AdaptiveMin,
+		"adaptive-max":             &c.AdaptiveMax,
+		"adaptive-step":            &c.AdaptiveStep,
+		"jitter":                   &c.Jitter,
+		"timeout":                  &c.HTTPTimeout,
+		"auth-token":               &c.AuthToken,
+		"auth-user":                &c.AuthUser,
+		"allow-insecure-auth":      &c.AllowInsecureAuth,
+		"auth-pass":                &c.AuthPass,
+		"header":                   &c.Headers,
+		"method":                   &c.Method,
+		"body":                     &c.Body,
+		"body-file":                &c.BodyFile,
+		"ca-file":                  &c.CAFile,
+		"cert-file":                &c.CertFile,
+		"key-file":                 &c.KeyFile,
+		"insecure-skip-verify":     &c.InsecureSkipVerify,
+		"proxy":                    &c.Proxy,
+		"resolve":                  &c.Resolve,
+		"max-redirects":            &c.MaxRedirects,
+		"retry-attempts":           &c.RetryAttempts,
+		"retry-backoff":            &c.RetryBackoff,
+		"breaker-failures":         &c.BreakerFailures,
+		"breaker-cooldown":         &c.BreakerCooldown,
+		"max-consecutive-failures": &c.MaxFailures,
+		"format":                   &c.Format,
+		"strict-fields":            &c.StrictFields,
+		"csv-line":                 &c.CSVLine,
+		"shutdown-timeout":         &c.ShutdownTimeout,
+		"alert-cooldown":           &c.AlertCooldown,
+		"state-file":               &c.StateFile,
+		"precision":                &c.Precision,
+		"units":                    &c.Units,
+		"maintenance":              &c.Maintenance,
+		"maintenance-until":        &c.MaintenanceUntil,
+		"quiet-hours":              &c.QuietHours,
+		"quiet-tz":                 &c.QuietTZ,
+		"notify-recovery":          &c.NotifyRecovery,
+		"no-summary":               &c.NoSummary,
+		"hysteresis":               &c.HysteresisBand,
+		"inclusive":                &c.Inclusive,
+		"breach-count":             &c.BreachCount,
+		"breach-rate":              &c.BreachRate,
+		"smooth-window":            &c.SmoothWindow,
+		"disk-eta-warn":            &c.DiskETAWarn,
+		"metrics-addr":             &c.MetricsAddr,
+		"health-addr":              &c.HealthAddr,
+		"statsd-addr":              &c.StatsdAddr,
+		"statsd-prefix":            &c.StatsdPrefix,
+		"graphite-addr":            &c.GraphiteAddr,
+		"graphite-prefix":          &c.GraphitePrefix,
+		"influx-url":               &c.InfluxURL,
+		"influx-token":             &c.InfluxToken,
+		"influx-org":               &c.InfluxOrg,
+		"influx-bucket":            &c.InfluxBucket,
+		"otlp-endpoint":            &c.OTLPEndpoint,
+		"otlp-insecure":            &c.OTLPInsecure,
+		"log-format":               &c.LogFormat,
+		"log-output":               &c.LogOutput,
+		"timestamps":               &c.Timestamps,
+		"tz":                       &c.TZ,
+		"color":                    &c.Color,
+		"log-level":                &c.LogLevel,
+		"log-file":                 &c.LogFile,
+		"log-max-size":             &c.LogMaxSize,
+		"log-max-backups":          &c.LogMaxBackups,
+		"log-echo":                 &c.LogEcho,
+		"slack-webhook":            &c.SlackWebhook,
+		"discord-webhook":          &c.DiscordWebhook,
+		"teams-webhook":            &c.TeamsWebhook,
+		"telegram-token":           &c.TelegramToken,
+		"telegram-chat-id":         &c.TelegramChatID,
+		"pagerduty-routing-key":    &c.PagerDutyKey,
+		"webhook-url":              &c.WebhookURL,
+		"webhook-template":         &c.WebhookTemplate,
+		"coalesce":                 &c.CoalesceWindow,
+		"notify-retries":           &c.NotifyRetries,
+		"notify-backoff":           &c.NotifyBackoff,
+		"notify-queue-size":        &c.NotifyQueueSize,
+		"deadletter-file":          &c.DeadLetterFile,
+		"notify-workers":           &c.NotifyWorkers,
+		"notify-buffer":            &c.NotifyBuffer,
+		"notify-block":             &c.NotifyBlock,
+		"syslog-addr":              &c.SyslogAddr,
+		"syslog-network":           &c.SyslogNetwork,
+		"escalate":                 &c.Escalate,
+		"load-threshold":           &c.LoadAverageThreshold,
+		"mem-threshold":            &c.MemoryUsageThreshold,
+		"disk-threshold":           &c.FreeDiscSpaceThreshold,
+		"net-threshold":            &c.NetworkBandwidthThreshold,
+		"enable-load":              &c.EnableLoad,
+		"enable-mem":               &c.EnableMemory,
+		"enable-disk":              &c.EnableDisk,
+		"enable-net":               &c.EnableNetwork,
+		"enable-leak":              &c.EnableLeak,
+		"leak-polls":               &c.LeakPolls,
+		"leak-delta":               &c.LeakDelta,
+		"net-spike":                &c.NetSpike,
+		"latency-warn":             &c.LatencyWarn,
+		"load-interval":            &c.LoadInterval,
+		"mem-interval":             &c.MemoryInterval,
+		"disk-interval":            &c.DiskInterval,
+		"net-interval":             &c.NetworkInterval,
+		"mem-free-min":             &c.MemoryFreeMin,
+		"disk-free-min":            &c.DiskFreeMin,
+		"health-floor":             &c.HealthFloor,
+		"weight-load":              &c.WeightLoad,
+		"weight-mem":               &c.WeightMemory,
+		"weight-disk":              &c.WeightDisk,
+		"weight-net":               &c.WeightNetwork,
+		"load-mode":                &c.LoadMode,
+		"cpu-cores":                &c.CPUCores,
+		"load-warn":                &c.LoadAverageWarn,
+		"mem-warn":                 &c.MemoryUsageWarn,
+		"disk-warn":                &c.FreeDiscSpaceWarn,
+		"net-warn":                 &c.NetworkBandwidthWarn,
+	}
+	for _, s := range c.secrets() {
+		fields[s.name+"-file"] = s.file
+	}
+	return fields
+}
+
+// envPrefix starts the environment variable of every flag, e.g.
+// MONITOR_MEM_THRESHOLD sets -mem-threshold.
+const envPrefix = "MONITOR_"
+
+// cliOnlyFlags are actions rather than settings, they have no variable.
+var cliOnlyFlags = map[string]bool{"version": true, "print-config": true}
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// loadEnv sets the settings from their environment variables, parsed and
+// checked like the flags. A repeatable flag takes comma-separated values,
+// so a header with a comma in its value has to be given otherwise.
+func (c *Config) loadEnv() error {
+	fs := newFlagSet(c)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil || cliOnlyFlags[f.Name] {
+			return
+		}
+		values := []string{value}
+		if list, ok := f.Value.(*listFlag); ok {
+			*list.list, values = nil, nil
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		for _, v := range values {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid %s %q: %w", envName(f.Name), value, e)
+				return
+			}
+		}
+	})
+	return err
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	var doc map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	fields := c.fileFields()
+	for key, node := range doc {
+		target, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("parse config %s: unknown field %q", path, key)
+		}
+		if err := node.Decode(target); err != nil {
+			return fmt.Errorf("parse config %s: field %q: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c.Count < 0 {
+		return fmt.Errorf("invalid count %d: must not be negative", c.Count)
+	}
+	if c.Count > 0 && c.Once {
+		return fmt.Errorf("invalid count: once already polls a single time")
+	}
+	if c.CountMode != countTotal && c.CountMode != countSuccessful {
+		return fmt.Errorf("invalid count-mode %q: must be %s or %s", c.CountMode, countTotal, countSuccessful)
+	}
+
+	if len(c.StatsURLs) == 0 {
+		return fmt.Errorf("invalid url: must not be empty")
+	}
+	for _, u := range c.StatsURLs {
+		if err := validateHTTPURL("url", u); err != nil {
+			return err
+		}
+	}
+	if c.Failover && len(c.StatsURLs) < 2 {
+		return fmt.Errorf("invalid failover: needs at least two url values")
+	}
+	if c.Source != "" {
+		if _, err := newFileSource(c.Source); err != nil {
+			return err
+		}
+	}
+	if c.SlackWebhook != "" {
+		if err := validateHTTPURL("slack-webhook", c.SlackWebhook); err != nil {
+			return err
+		}
+	}
+	if c.DiscordWebhook != "" {
+		if err := validateHTTPURL("discord-webhook", c.DiscordWebhook); err != nil {
+			return err
+		}
+	}
+	if c.TeamsWebhook != "" {
+		if err := validateHTTPURL("teams-webhook", c.TeamsWebhook); err != nil {
+			return err
+		}
+	}
+	if c.WebhookURL != "" {
+		if err := validateHTTPURL("webhook-url", c.WebhookURL); err != nil {
+			return err
+		}
+		if _, err := parseWebhookTemplate(c.WebhookTemplate); err != nil {
+			return fmt.Errorf("invalid webhook-template: %w", err)
+		}
+	}
+	if c.CoalesceWindow < 0 {
+		return fmt.Errorf("invalid coalesce %v: must not be negative", c.CoalesceWindow)
+	}
+	if c.NotifyRetries < 0 {
+		return fmt.Errorf("invalid notify-retries %d: must not be negative", c.NotifyRetries)
+	}
+	if c.NotifyBackoff <= 0 {
+		return fmt.Errorf("invalid notify-backoff %v: must be positive", c.NotifyBackoff)
+	}
+	if c.NotifyQueueSize < 1 {
+		return fmt.Errorf("invalid notify-queue-size %d: must be at least 1", c.NotifyQueueSize)
+	}
+	if c.NotifyWorkers < 0 {
+		return fmt.Errorf("invalid notify-workers %d: must not be negative", c.NotifyWorkers)
+	}
+	if c.NotifyBuffer < 0 {
+		return fmt.Errorf("invalid notify-buffer %d: must not be negative", c.NotifyBuffer)
+	}
+	if c.NotifyBlock < 0 {
+		return fmt.Errorf("invalid notify-block %v: must not be negative", c.NotifyBlock)
+	}
+	if c.DeadLetterFile != "" {
+		if err := checkAppendable(c.DeadLetterFile); err != nil {
+			return fmt.Errorf("invalid deadletter-file: %w", err)
+		}
+	}
+	if c.SyslogAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SyslogAddr); err != nil {
+			return fmt.Errorf("invalid syslog-addr: %w", err)
+		}
+		if c.SyslogNetwork != "udp" && c.SyslogNetwork != "tcp" {
+			return fmt.Errorf("invalid syslog-network %q: must be udp or tcp", c.SyslogNetwork)
+		}
+	}
+	enabled := c.notifierNames()[1:]
+	for _, s := range c.Escalate {
+		e, err := parseEscalation(s)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(enabled, e.notifier) {
+			return fmt.Errorf("invalid escalate %q: notifier %s is not configured", s, e.notifier)
+		}
+	}
+	if c.PollingInterval <= 0 {
+		return fmt.Errorf("invalid interval %v: must be positive", c.PollingInterval)
+	}
+	for _, i := range []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"load-interval", c.LoadInterval},
+		{"mem-interval", c.MemoryInterval},
+		{"disk-interval", c.DiskInterval},
+		{"net-interval", c.NetworkInterval},
+	} {
+		if i.interval != 0 && i.interval < c.PollingInterval {
+			return fmt.Errorf("invalid %s %v: must be 0 or at least interval %v, lower interval to evaluate a metric more often", i.name, i.interval, c.PollingInterval)
+		}
+	}
+	if c.Adaptive {
+		if c.AdaptiveMin <= 0 || c.AdaptiveStep <= 0 {
+			return fmt.Errorf("invalid adaptive polling: adaptive-min and adaptive-step must be positive")
+		}
+		if c.AdaptiveMax < c.AdaptiveMin {
+			return fmt.Errorf("invalid adaptive-max %v: must not be under adaptive-min %v", c.AdaptiveMax, c.AdaptiveMin)
+		}
+		if c.PollingInterval < c.AdaptiveMin || c.PollingInterval > c.AdaptiveMax {
+			return fmt.Errorf("invalid interval %v: must be within adaptive-min %v and adaptive-max %v", c.PollingInterval, c.AdaptiveMin, c.AdaptiveMax)
+		}
+	}
+	if c.Jitter < 0 || c.Jitter >= 100 {
+		return fmt.Errorf("invalid jitter %v: must be at least 0%% and under 100%%", &c.Jitter)
+	}
+	if c.HTTPTimeout <= 0 {
+		return fmt.Errorf("invalid timeout %v: must be positive", c.HTTPTimeout)
+	}
+
+	if (c.AuthUser == "") != (c.AuthPass == "") {
+		return fmt.Errorf("invalid basic auth: auth-user and auth-pass must be set together")
+	}
+
+	if urls := c.insecureAuthURLs(); len(urls) > 0 && !c.AllowInsecureAuth {
+		return fmt.Errorf("invalid auth: credentials would be sent in the clear to %s, use https or set allow-insecure-auth", strings.Join(urls, ", "))
+	}
+
+	if (c.TelegramToken == "") != (c.TelegramChatID == "") {
+		return fmt.Errorf("invalid telegram: telegram-token and telegram-chat-id must be set together")
+	}
+
+	if _, err := parseHeaders(c.Headers); err != nil {
+		return err
+	}
+	switch c.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("invalid method %q: must be GET, POST, PUT or PATCH", c.Method)
+	}
+	if c.Body != "" && c.BodyFile != "" {
+		return fmt.Errorf("invalid body: body and body-file are mutually exclusive")
+	}
+	if (c.Body != "" || c.BodyFile != "") && c.Method == http.MethodGet {
+		return fmt.Errorf("invalid body: a %s request has no body", c.Method)
+	}
+	if c.BodyFile != "" {
+		if _, err := os.Stat(c.BodyFile); err != nil {
+			return fmt.Errorf("invalid body-file: %w", err)
+		}
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("invalid client certificate: cert-file and key-file must be set together")
+	}
+
+	if c.MaxRedirects < 0 {
+		return fmt.Errorf("invalid max-redirects %d: must not be negative", c.MaxRedirects)
+	}
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return fmt.Errorf("invalid proxy %q: scheme must be http, https or socks5", c.Proxy)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid proxy %q: missing host", c.Proxy)
+		}
+	}
+	if _, err := parseResolves(c.Resolve); err != nil {
+		return err
+	}
+
+	if c.RetryAttempts < 1 {
+		return fmt.Errorf("invalid retry-attempts %d: must be at least 1", c.RetryAttempts)
+	}
+	if c.RetryBackoff <= 0 {
+		return fmt.Errorf("invalid retry-backoff %v: must be positive", c.RetryBackoff)
+	}
+	if c.BreakerFailures < 0 {
+		return fmt.Errorf("invalid breaker-failures %d: must not be negative", c.BreakerFailures)
+	}
+	if c.BreakerCooldown <= 0 {
+		return fmt.Errorf("invalid breaker-cooldown %v: must be positive", c.BreakerCooldown)
+	}
+	if c.MaxFailures < 0 {
+		return fmt.Errorf("invalid max-consecutive-failures %d: must not be negative", c.MaxFailures)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown-timeout %v: must be positive", c.ShutdownTimeout)
+	}
+
+	if c.AlertCooldown < 0 {
+		return fmt.Errorf("invalid alert-cooldown %v: must not be negative", c.AlertCooldown)
+	}
+
+	if c.HysteresisBand < 0 {
+		return fmt.Errorf("invalid hysteresis %v: must not be negative", c.HysteresisBand)
+	}
+
+	if c.BreachCount < 1 {
+		return fmt.Errorf("invalid breach-count %d: must be at least 1", c.BreachCount)
+	}
+	for _, s := range c.BreachRate {
+		if _, _, err := parseBreachRate(s); err != nil {
+			return err
+		}
+	}
+
+	if c.SmoothWindow < 1 {
+		return fmt.Errorf("invalid smooth-window %d: must be at least 1", c.SmoothWindow)
+	}
+
+	if c.LeakPolls < 1 {
+		return fmt.Errorf("invalid leak-polls %d: must be at least 1", c.LeakPolls)
+	}
+	if c.LeakDelta <= 0 {
+		return fmt.Errorf("invalid leak-delta %v: must be positive", c.LeakDelta)
+	}
+
+	if c.NetSpike < 0 {
+		return fmt.Errorf("invalid net-spike %v: must not be negative", c.NetSpike)
+	}
+	if c.LatencyWarn < 0 {
+		return fmt.Errorf("invalid latency-warn %v: must not be negative", c.LatencyWarn)
+	}
+	if c.HealthFloor < 0 || c.HealthFloor > 100 {
+		return fmt.Errorf("invalid health-floor %v: must be between 0 and 100", c.HealthFloor)
+	}
+	for _, w := range []struct {
+		name  string
+		value float64
+	}{
+		{"weight-load", c.WeightLoad},
+		{"weight-mem", c.WeightMemory},
+		{"weight-disk", c.WeightDisk},
+		{"weight-net", c.WeightNetwork},
+	} {
+		if w.value < 0 {
+			return fmt.Errorf("invalid %s %v: must not be negative", w.name, w.value)
+		}
+	}
+
+	if c.DiskETAWarn < 0 {
+		return fmt.Errorf("invalid disk-eta-warn %v: must not be negative", c.DiskETAWarn)
+	}
+
+	if _, ok := parserFor(c.Format, parseOptions{}); !ok {
+		return fmt.Errorf("invalid format %q: must be %s, %s, %s or a registered parser", c.Format, formatAuto, formatCSV, formatJSON)
+	}
+	if _, err := time.LoadLocation(c.TZ); err != nil {
+		return fmt.Errorf("invalid tz %q: %w", c.TZ, err)
+	}
+	if c.Color != colorAuto && c.Color != colorAlways && c.Color != colorNever {
+		return fmt.Errorf("invalid color %q: must be %s, %s or %s", c.Color, colorAuto, colorAlways, colorNever)
+	}
+	if c.Precision < 0 || c.Precision > maxPrecision {
+		return fmt.Errorf("invalid precision %d: must be between 0 and %d", c.Precision, maxPrecision)
+	}
+	if c.Units != unitsMb && c.Units != unitsBinary && c.Units != unitsSI {
+		return fmt.Errorf("invalid units %q: must be %s, %s or %s", c.Units, unitsMb, unitsBinary, unitsSI)
+	}
+	if c.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddr); err != nil {
+			return fmt.Errorf("invalid statsd-addr: %w", err)
+		}
+	}
+	if c.GraphiteAddr != "" {
+		if _, _, err := net.SplitHostPort(c.GraphiteAddr); err != nil {
+			return fmt.Errorf("invalid graphite-addr: %w", err)
+		}
+	}
+	if c.InfluxURL != "" {
+		if err := validateHTTPURL("influx-url", c.InfluxURL); err != nil {
+			return err
+		}
+		if c.InfluxOrg == "" || c.InfluxBucket == "" {
+			return fmt.Errorf("invalid influx: influx-org and influx-bucket must be set with influx-url")
+		}
+	}
+	if c.OTLPEndpoint != "" {
+		if _, _, err := net.SplitHostPort(c.OTLPEndpoint); err != nil {
+			return fmt.Errorf("invalid otlp-endpoint: %w", err)
+		}
+	}
+	if c.MaintenanceUntil != "" {
+		if _, err := time.Parse(time.RFC3339, c.MaintenanceUntil); err != nil {
+			return fmt.Errorf("invalid maintenance-until: %w", err)
+		}
+	}
+	for _, w := range c.Maintenance {
+		if _, err := w.contains(time.Now()); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.QuietHours {
+		if _, err := parseQuietHours(s); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(c.QuietTZ); err != nil {
+		return fmt.Errorf("invalid quiet-tz %q: %w", c.QuietTZ, err)
+	}
+	if c.CSVLine != csvLineFirst && c.CSVLine != csvLineLast {
+		return fmt.Errorf("invalid csv-line %q: must be %s or %s", c.CSVLine, csvLineFirst, csvLineLast)
+	}
+	if c.LogFormat != logFormatText && c.LogFormat != logFormatJSON {
+		return fmt.Errorf("invalid log-format %q: must be %s or %s", c.LogFormat, logFormatText, logFormatJSON)
+	}
+
+	if c.LogOutput != logOutputStdout && c.LogOutput != logOutputJournald {
+		return fmt.Errorf("invalid log-output %q: must be %s or %s", c.LogOutput, logOutputStdout, logOutputJournald)
+	}
+	if c.LogOutput == logOutputJournald && c.LogFile != "" {
+		return fmt.Errorf("invalid log-output %s: log-file can't be used with it", c.LogOutput)
+	}
+
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log-level %q: must be debug, info, warn or error", c.LogLevel)
+	}
+
+	if c.LogMaxSize <= 0 {
+		return fmt.Errorf("invalid log-max-size %d: must be positive", c.LogMaxSize)
+	}
+	if c.LogMaxBackups < 0 {
+		return fmt.Errorf("invalid log-max-backups %d: must not be negative", c.LogMaxBackups)
+	}
+
+	if c.LoadAverageThreshold < 0 {
+		return fmt.Errorf("invalid load-threshold %v: must not be negative", c.LoadAverageThreshold)
+	}
+	if c.LoadMode != loadModeAbsolute && c.LoadMode != loadModePerCore {
+		return fmt.Errorf("invalid load-mode %q: must be %s or %s", c.LoadMode, loadModeAbsolute, loadModePerCore)
+	}
+	if c.CPUCores < 0 {
+		return fmt.Errorf("invalid cpu-cores %d: must not be negative", c.CPUCores)
+	}
+	if c.LoadAverageWarn < 0 {
+		return fmt.Errorf("invalid load-warn %v: must not be negative", c.LoadAverageWarn)
+	}
+
+	pcts := []struct {
+		name  string
+		value float64
+	}{
+		{"mem-threshold", c.MemoryUsageThreshold},
+		{"disk-threshold", c.FreeDiscSpaceThreshold},
+		{"net-threshold", c.NetworkBandwidthThreshold},
+		{"mem-warn", c.MemoryUsageWarn},
+		{"disk-warn", c.FreeDiscSpaceWarn},
+		{"net-warn", c.NetworkBandwidthWarn},
+	}
+	for _, p := range pcts {
+		if p.value < 0 || p.value > 100 {
+			return fmt.Errorf("invalid %s %v: must be between 0 and 100", p.name, p.value)
+		}
+	}
+
+	levels := []struct {
+		warn, critical       string
+		warnValue, critValue float64
+	}{
+		{"load-warn", "load-threshold", c.LoadAverageWarn, c.LoadAverageThreshold},
+		{"mem-warn", "mem-threshold", c.MemoryUsageWarn, c.MemoryUsageThreshold},
+		{"disk-warn", "disk-threshold", c.FreeDiscSpaceWarn, c.FreeDiscSpaceThreshold},
+		{"net-warn", "net-threshold", c.NetworkBandwidthWarn, c.NetworkBandwidthThreshold},
+	}
+	for _, l := range levels {
+		if l.warnValue > l.critValue {
+			return fmt.Errorf("invalid %s %v: must not be above %s %v", l.warn, l.warnValue, l.critical, l.critValue)
+		}
+	}
+
+	return nil
+}
+
+func validateHTTPURL(name, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid %s %q: scheme must be http or https", name, raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid %s %q: missing host", name, raw)
+	}
+	return nil
+}
+
+func parseHeaders(raw []string) (http.Header, error) {
+	h := make(http.Header, len(raw))
+	for _, line := range raw {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q: must be in \"Name: Value\" form", line)
+		}
+		h.Add(name, strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// requestBody returns the stats request body, the body file is read
+// on every call so it can be changed without a reload.
+func (c *Config) requestBody() ([]byte, error) {
+	if c.BodyFile != "" {
+		return os.ReadFile(c.BodyFile)
+	}
+	return []byte(c.Body), nil
+}
+
+// servers names the monitored servers. A source replaces the stats
+// endpoints and failover endpoints are named after the first one.
+func (c *Config) servers() []string {
+	switch {
+	case c.Source != "":
+		return []string{c.Source}
+	case c.Failover:
+		return c.StatsURLs[:1]
+	}
+	return c.StatsURLs
+}
+
+// Warnings lists the valid but likely unintended settings.
+func (c *Config) Warnings() []string {
+	var out []string
+	if !c.Once && c.HTTPTimeout > c.PollingInterval {
+		out = append(out, fmt.Sprintf("timeout %v is larger than interval %v, polls may overlap", c.HTTPTimeout, c.PollingInterval))
+	}
+	if c.InsecureSkipVerify {
+		out = append(out, "insecure-skip-verify is enabled, the stats endpoint certificate is not verified")
+	}
+	if urls := c.insecureAuthURLs(); len(urls) > 0 {
+		out = append(out, fmt.Sprintf("allow-insecure-auth is enabled, credentials are sent in the clear to %s", strings.Join(urls, ", ")))
+	}
+	return out
+}
+
+// insecureAuthURLs lists the http:// stats URLs that get credentials,
+// from the auth settings, an Authorization header or their own user info.
+// They are redacted.
+func (c *Config) insecureAuthURLs() []string {
+	if c.Source != "" {
+		return nil
+	}
+	auth := c.AuthToken != "" || c.AuthUser != ""
+	for _, h := range c.Headers {
+		name, _, _ := strings.Cut(h, ":")
+		auth = auth || strings.EqualFold(strings.TrimSpace(name), "Authorization")
+	}
+	var out []string
+	for _, raw := range c.StatsURLs {
+		u, err := url.Parse(raw)
+		if err != nil || !strings.EqualFold(u.Scheme, "http") {
+			continue
+		}
+		if auth || u.User != nil {
+			out = append(out, u.Redacted())
+		}
+	}
+	return out
+}
+
+// stringList accepts either a single YAML string or a sequence of them.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
+
+// listFlag is a repeatable flag, values given on the command line
+// replace the default ones instead of being appended to them.
+type listFlag struct {
+	list *stringList
+	set  bool
+}
+
+func (f *listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	if !f.set {
+		*f.list = nil
+		f.set = true
+	}
+	*f.list = append(*f.list, value)
+	return nil
+}
+
+// percentage is a flag and config value given as "20%" or "20".
+type percentage float64
+
+func (p *percentage) String() string {
+	return strconv.FormatFloat(float64(*p), 'g', -1, 64) + "%"
+}
+
+func (p *percentage) Set(value string) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage %q", value)
+	}
+	*p = percentage(v)
+	return nil
+}
+
+func (p *percentage) UnmarshalYAML(node *yaml.Node) error {
+	return p.Set(node.Value)
+}
+
+// byteSize is a flag and config value given in bytes, optionally with
+// a decimal (k, M, G, T, P) or binary (Ki, Mi, Gi, Ti, Pi) suffix and a
+// trailing B, e.g. "10Gi", "500MB" or "1048576".
+type byteSize float64
+
+var sizeSuffixes = []struct {
+	suffix string
+	scale  float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50},
+	{"k", 1e3}, {"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15},
+}
+
+func parseSize(s string) (float64, error) {
+	v := strings.TrimSpace(s)
+	v = strings.TrimSuffix(v, "B")
+	scale := 1.0
+	for _, u := range sizeSuffixes {
+		if strings.HasSuffix(v, u.suffix) {
+			v, scale = strings.TrimSuffix(v, u.suffix), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * scale, nil
+}
+
+func (b *byteSize) String() string {
+	return strconv.FormatFloat(float64(*b), 'f', -1, 64)
+}
+
+func (b *byteSize) Set(value string) error {
+	v, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(v)
+	return nil
+}
+
+func (b *byteSize) UnmarshalYAML(node *yaml.Node) error {
+	return b.Set(node.Value)
+}
+
+func (b byteSize) MarshalYAML() (any, error) {
+	return b.String(), nil
+}
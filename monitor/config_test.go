@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigBadArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  error
+	}{
+		{"unknown flag", []string{"-no-such-flag"}, ErrUsage},
+		{"bad value", []string{"-interval", "soon"}, ErrUsage},
+		{"help", []string{"-h"}, flag.ErrHelp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(tt.args)
+			if !errors.Is(err, tt.err) || cfg != nil {
+				t.Errorf("LoadConfig(%q) = %v, %v, want nil, %v", tt.args, cfg, err, tt.err)
+			}
+		})
+	}
+
+	// a valid command line with invalid settings is not a usage error
+	if _, err := LoadConfig([]string{"-interval", "0s"}); err == nil || errors.Is(err, ErrUsage) {
+		t.Errorf("LoadConfig(-interval 0s) error = %v, want a validation error", err)
+	}
+}
+
+func TestValidateDeadLetterFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.jsonl")
+	if err := os.WriteFile(existing, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		path  string
+		valid bool
+	}{
+		{"missing file", filepath.Join(dir, "dead.jsonl"), true},
+		{"existing file", existing, true},
+		{"missing directory", filepath.Join(dir, "missing", "dead.jsonl"), false},
+		{"directory", dir, false},
+		{"file as a directory", filepath.Join(existing, "dead.jsonl"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("http://127.0.0.1:1/_stats")
+			cfg.DeadLetterFile = tt.path
+			if err := cfg.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dead.jsonl")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("validate created the dead-letter file: %v", err)
+	}
+}
+
+func TestNewCreatesDeadLetterFile(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "dead.jsonl")
+		cfg := testConfig("http://127.0.0.1:1/_stats")
+		cfg.DeadLetterFile = path
+		cfg.DryRun = dryRun
+		m, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		m.close()
+		if _, err := os.Stat(path); (err == nil) == dryRun {
+			t.Errorf("dry-run %t: stat dead-letter file: %v", dryRun, err)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  float64
+		valid bool
+	}{
+		{"1048576", 1 << 20, true},
+		{"0", 0, true},
+		{"10Gi", 10 << 30, true},
+		{"10GiB", 10 << 30, true},
+		{"512Mi", 512 << 20, true},
+		{"1.5Ki", 1536, true},
+		{"500MB", 500e6, true},
+		{"2G", 2e9, true},
+		{"1k", 1e3, true},
+		{"1K", 1e3, true},
+		{"3T", 3e12, true},
+		{"1Pi", 1 << 50, true},
+		{"100B", 100, true},
+		{" 10 Gi ", 10 << 30, true},
+		{"", 0, false},
+		{"B", 0, false},
+		{"Gi", 0, false},
+		{"-1Gi", 0, false},
+		{"10X", 0, false},
+		{"10gi", 0, false},
+		{"ten", 0, false},
+		{"InfGi", 0, false},
+		{"NaN", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("parseSize(%q) = %v, %v, want %v, valid %t", tt.in, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestLoadConfigSizes(t *testing.T) {
+	cfg, err := LoadConfig([]string{"-disk-free-min", "10Gi", "-mem-free-min", "512MB"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.DiskFreeMin != 10<<30 || cfg.MemoryFreeMin != 512e6 {
+		t.Errorf("disk-free-min, mem-free-min = %v, %v, want %v, %v", cfg.DiskFreeMin, cfg.MemoryFreeMin, 10<<30, 512e6)
+	}
+	if _, err := LoadConfig([]string{"-disk-free-min", "10 gigs"}); !errors.Is(err, ErrUsage) {
+		t.Errorf("LoadConfig(-disk-free-min 10 gigs) error = %v, want %v", err, ErrUsage)
+	}
+}
+
+func TestValidateAdaptiveInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		valid    bool
+	}{
+		{"at adaptive-min", time.Second, true},
+		{"inside", 10 * time.Second, true},
+		{"at adaptive-max", 30 * time.Second, true},
+		{"under adaptive-min", 500 * time.Millisecond, false},
+		{"over adaptive-max", time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("http://127.0.0.1:1/_stats")
+			cfg.Adaptive = true
+			cfg.AdaptiveMin, cfg.AdaptiveMax = time.Second, 30*time.Second
+			cfg.PollingInterval = tt.interval
+			cfg.HTTPTimeout = tt.interval / 2
+			if err := cfg.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestLoadConfigVersionIgnoresEnv(t *testing.T) {
+	t.Setenv(envName("interval"), "bogus")
+	cfg, err := LoadConfig([]string{"-version"})
+	if err != nil || !cfg.Version {
+		t.Fatalf("LoadConfig(-version) = %v, %v, want the version config", cfg, err)
+	}
+	if _, err := LoadConfig(nil); err == nil {
+		t.Errorf("LoadConfig with %s=bogus succeeded", envName("interval"))
+	}
+}
@@ -0,0 +1,125 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// default notification dispatch settings
+	notifyBuffer = 64
+	notifyBlock  = time.Second
+)
+
+type dispatchJob struct {
+	ctx   context.Context
+	next  Notifier
+	alert Alert
+}
+
+// dispatchPool delivers alerts on worker goroutines so that a slow
+// notifier doesn't hold up the polls. Every notifier is bound to one
+// worker, so its alerts are delivered in the order they were raised,
+// while alerts to notifiers on different workers are delivered
+// independently of each other. With more notifiers than workers they
+// share them round-robin.
+//
+// When the queue of a worker is full, Notify waits up to block for room
+// and then drops the alert.
+type dispatchPool struct {
+	block time.Duration
+
+	mu      sync.RWMutex
+	closed  bool
+	queues  []chan dispatchJob
+	workers sync.WaitGroup
+}
+
+func newDispatchPool(workers, buffer int, block time.Duration) *dispatchPool {
+	p := &dispatchPool{block: block, queues: make([]chan dispatchJob, workers)}
+	for i := range p.queues {
+		q := make(chan dispatchJob, buffer)
+		p.queues[i] = q
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range q {
+				if err := job.next.Notify(job.ctx, job.alert); err != nil {
+					slog.Error("Unable to send notification.", "notifier", fmt.Sprintf("%T", unwrapNotifier(job.next)), "error", err)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// wrap binds the notifiers to the workers.
+func (p *dispatchPool) wrap(ns []Notifier) {
+	for i, n := range ns {
+		ns[i] = &dispatchedNotifier{next: n, pool: p, worker: i % len(p.queues)}
+	}
+}
+
+func (p *dispatchPool) dispatch(worker int, job dispatchJob) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	// alerts of polls that outlived the shutdown are sent right away
+	if p.closed {
+		if err := job.next.Notify(job.ctx, job.alert); err != nil {
+			slog.Error("Unable to send notification.", "notifier", fmt.Sprintf("%T", unwrapNotifier(job.next)), "error", err)
+		}
+		return
+	}
+
+	select {
+	case p.queues[worker] <- job:
+		return
+	default:
+	}
+	timer := time.NewTimer(p.block)
+	defer timer.Stop()
+	select {
+	case p.queues[worker] <- job:
+	case <-timer.C:
+		slog.Warn("Notification dropped, the dispatch queue is full.", "notifier", fmt.Sprintf("%T", unwrapNotifier(job.next)), "metric", job.alert.Metric, "server", job.alert.Server)
+	}
+}
+
+// close waits for the workers to deliver the queued alerts.
+func (p *dispatchPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// dispatchedNotifier hands the alerts of next to its pool worker.
+type dispatchedNotifier struct {
+	next   Notifier
+	pool   *dispatchPool
+	worker int
+}
+
+// Notify queues the alert, the delivery is not tied to the poll that
+// raised it so that it isn't cut short at shutdown.
+func (n *dispatchedNotifier) Notify(ctx context.Context, a Alert) error {
+	n.pool.dispatch(n.worker, dispatchJob{ctx: context.WithoutCancel(ctx), next: n.next, alert: a})
+	return nil
+}
+
+// Close drains the pool before closing next, the first notifier closed
+// drains it for all of them.
+func (n *dispatchedNotifier) Close() error {
+	n.pool.close()
+	return closeNotifier(n.next)
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import "errors"
+
+// fetch errors
+var ErrBadStatus = errors.New("bad status")
+
+// ErrTooManyRedirects is returned when a stats request is redirected
+// more than -max-redirects times.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrTooManyFailures ends Run when a server fails more consecutive polls
+// than allowed. It is the only fatal error of a run, the errors of single
+// polls and notifications are logged and counted and the run goes on.
+var ErrTooManyFailures = errors.New("too many consecutive poll failures")
+
+// ErrUsage is returned by LoadConfig for a bad command line, the error
+// and the usage are already printed to stderr. It wraps flag.ErrHelp when
+// the help was asked for.
+var ErrUsage = errors.New("invalid command line")
+
+// ErrClosed is returned by Run on a Monitor that already ran, its outputs
+// are released.
+var ErrClosed = errors.New("monitor already ran")
+
+// parse errors
+var (
+	ErrEmptyBody          = errors.New("empty body")
+	ErrFieldCount         = errors.New("unexpected field number")
+	ErrTooManyParseErrors = errors.New("too may errors")
+	ErrMalformedBody      = errors.New("malformed body")
+	ErrMissingFields      = errors.New("missing fields")
+	ErrZeroTotal          = errors.New("zero total")
+	ErrUsedOverTotal      = errors.New("used over total")
+	ErrLoadOutOfRange     = errors.New("load average out of range")
+)
+
+// parseErrors name every parse error for the invalid stats counter.
+var parseErrors = []struct {
+	err    error
+	reason string
+}{
+	{ErrEmptyBody, "empty_body"},
+	{ErrFieldCount, "field_count"},
+	{ErrTooManyParseErrors, "too_many_errors"},
+	{ErrMalformedBody, "malformed_body"},
+	{ErrMissingFields, "missing_fields"},
+	{ErrZeroTotal, "zero_total"},
+	{ErrUsedOverTotal, "used_over_total"},
+	{ErrLoadOutOfRange, "load_out_of_range"},
+}
+
+// parseErrorReason names the parse error in err, it is empty for
+// other errors.
+func parseErrorReason(err error) string {
+	for _, pe := range parseErrors {
+		if errors.Is(err, pe.err) {
+			return pe.reason
+		}
+	}
+	return ""
+}
+
+// isParseError reports whether err comes from a stats body the monitor
+// could fetch but not make sense of.
+func isParseError(err error) bool {
+	return parseErrorReason(err) != ""
+}
@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// escalation is a rung of the escalation ladder: a breach of severity
+// still active after the delay is also sent to the notifier.
+type escalation struct {
+	severity string
+	after    time.Duration
+	notifier string
+}
+
+// parseEscalation parses a "critical:15m:pagerduty" escalation.
+func parseEscalation(s string) (escalation, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return escalation{}, fmt.Errorf("invalid escalate %q: must be severity:delay:notifier", s)
+	}
+	e := escalation{severity: strings.TrimSpace(parts[0]), notifier: strings.TrimSpace(parts[2])}
+	if e.severity != severityWarning && e.severity != severityCritical {
+		return escalation{}, fmt.Errorf("invalid escalate %q: severity must be %s or %s", s, severityWarning, severityCritical)
+	}
+	after, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return escalation{}, fmt.Errorf("invalid escalate %q: %w", s, err)
+	}
+	if after <= 0 {
+		return escalation{}, fmt.Errorf("invalid escalate %q: delay must be positive", s)
+	}
+	e.after = after
+	return e, nil
+}
+
+// escalations returns the ladder of severity, the shortest delay first.
+// The config is validated, so the escalations parse.
+func (c *Config) escalations(severity string) []escalation {
+	var out []escalation
+	for _, s := range c.Escalate {
+		if e, _ := parseEscalation(s); e.severity == severity {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].after < out[j].after })
+	return out
+}
+
+// escalationTargets are the notifiers that only get escalations.
+func (c *Config) escalationTargets() map[string]bool {
+	targets := make(map[string]bool)
+	for _, s := range c.Escalate {
+		e, _ := parseEscalation(s)
+		targets[e.notifier] = true
+	}
+	return targets
+}
+
+// escalate sends the breach of key to the notifiers of the rungs it
+// reached since the last poll, alert carries the breach message.
+func (p *poller) escalate(ctx context.Context, cfg *Config, key string, alert Alert) {
+	rungs := cfg.escalations(alert.Severity)
+	since, due := p.state.escalate(key, rungs, alert.Time)
+	if len(due) == 0 {
+		return
+	}
+	alert.Message = fmt.Sprintf("Escalated after %v: %s", alert.Time.Sub(since).Round(time.Second), alert.Message)
+	alert.Message = p.tag(cfg, alert.Message)
+	targets := p.escalatedTo(due)
+	slog.WarnContext(bare(ctx), alert.Message, "server", p.url, "metric", alert.Metric, "notifiers", len(targets))
+	targets.Notify(ctx, alert)
+}
+
+// escalatedTo returns the notifiers of the rungs, each one once.
+func (p *poller) escalatedTo(rungs []escalation) notifiers {
+	var ns notifiers
+	seen := make(map[string]bool)
+	for _, e := range rungs {
+		if n, ok := p.escalation[e.notifier]; ok && !seen[e.notifier] {
+			seen[e.notifier] = true
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
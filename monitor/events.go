@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// eventBufferSize is the default capacity of the Events channel.
+const eventBufferSize = 64
+
+// EventKind tells what an Event reports.
+type EventKind string
+
+const (
+	// EventPoll is a finished poll, successful or not
+	EventPoll EventKind = "poll"
+	// EventAlert is a breach alert
+	EventAlert EventKind = "alert"
+	// EventRecover is the recovery of a breached metric
+	EventRecover EventKind = "recover"
+)
+
+// Event is a poll result, alert or recovery of a server.
+type Event struct {
+	Kind   EventKind
+	Server string
+	Time   time.Time
+	// Stats is set on polls that got the stats parsed
+	Stats *Stats
+	// Err is set on failed polls
+	Err error
+	// Alert is set on alerts and recoveries
+	Alert *Alert
+}
+
+// eventStream is a buffered channel of events that never blocks the
+// sender, events that don't fit in the buffer are dropped.
+type eventStream struct {
+	mu     sync.Mutex
+	ch     chan Event
+	closed bool
+}
+
+func newEventStream(size int) *eventStream {
+	return &eventStream{ch: make(chan Event, size)}
+}
+
+func (s *eventStream) send(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+		slog.Debug("Event dropped, the consumer is too slow.", "kind", e.Kind, "server", e.Server)
+	}
+}
+
+// close closes the channel, polls aborted at shutdown may still finish
+// afterwards and their events are discarded.
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// eventNotifier turns alerts into events. It resolves, so every
+// recovery is streamed.
+type eventNotifier struct {
+	events *eventStream
+}
+
+func (n eventNotifier) resolves() {}
+
+func (n eventNotifier) local() {}
+
+func (n eventNotifier) Notify(_ context.Context, a Alert) error {
+	kind := EventAlert
+	if a.Recovered {
+		kind = EventRecover
+	}
+	n.events.send(Event{Kind: kind, Server: a.Server, Time: a.Time, Alert: &a})
+	return nil
+}
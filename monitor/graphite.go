@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	graphitePrefix = "stat_loader"
+
+	// graphiteBuffer is how many polls are kept while the receiver is
+	// unreachable, older ones are dropped
+	graphiteBuffer       = 256
+	graphiteRetryDelay   = time.Second
+	graphiteDialTimeout  = 5 * time.Second
+	graphiteWriteTimeout = 5 * time.Second
+)
+
+// graphiteWriter sends the stats to a carbon receiver in the plaintext
+// protocol over TCP. The polls only queue their lines, a goroutine writes
+// them and reconnects when the connection breaks.
+type graphiteWriter struct {
+	addr   string
+	prefix string
+
+	mu     sync.Mutex
+	closed bool
+	lines  chan string
+	// stop ends the reconnects at shutdown, done is closed once the
+	// writer goroutine returned
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newGraphiteWriter(addr, prefix string) *graphiteWriter {
+	w := &graphiteWriter{
+		addr:   addr,
+		prefix: prefix,
+		lines:  make(chan string, graphiteBuffer),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send queues the metrics of a poll, host is added to the names when it
+// is not empty. The score is left out when there is none.
+func (w *graphiteWriter) send(host string, stats *Stats, score *float64, now time.Time) {
+	name := w.prefix
+	if host != "" {
+		name += "." + host
+	}
+
+	var b strings.Builder
+	ts := now.Unix()
+	for _, m := range []struct {
+		metric string
+		value  float64
+	}{
+		{metricLoadAverage, stats.LoadAverage},
+		{metricMemoryUsage, stats.MemoryUsage()},
+		{metricDiskUsage, stats.DiskUsage()},
+		{metricNetworkUsage, stats.NetworkUsage()},
+	} {
+		fmt.Fprintf(&b, "%s.%s %g %d\n", name, m.metric, m.value, ts)
+	}
+	if score != nil {
+		fmt.Fprintf(&b, "%s.%s %g %d\n", name, metricHealthScore, *score, ts)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.lines <- b.String():
+	default:
+		slog.Warn("Graphite buffer full, metrics dropped.", "addr", w.addr)
+	}
+}
+
+// close sends the queued metrics, giving up on them after timeout.
+func (w *graphiteWriter) close(timeout time.Duration) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.closed = true
+	close(w.lines)
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-time.After(timeout):
+		slog.Warn("Unable to send the queued Graphite metrics before shutdown.", "addr", w.addr)
+	}
+	close(w.stop)
+}
+
+func (w *graphiteWriter) run() {
+	defer close(w.done)
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for lines := range w.lines {
+		for {
+			if conn == nil {
+				c, err := net.DialTimeout("tcp", w.addr, graphiteDialTimeout)
+				if err != nil {
+					slog.Warn("Unable to connect to Graphite.", "addr", w.addr, "error", err)
+					if !w.wait() {
+						return
+					}
+					continue
+				}
+				conn = c
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(graphiteWriteTimeout))
+			if _, err := conn.Write([]byte(lines)); err != nil {
+				slog.Warn("Unable to send Graphite metrics.", "addr", w.addr, "error", err)
+				conn.Close()
+				conn = nil
+				if !w.wait() {
+					return
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// wait pauses before a reconnect, it is false once the shutdown gave up
+// on the queued metrics.
+func (w *graphiteWriter) wait() bool {
+	select {
+	case <-w.stop:
+		return false
+	case <-time.After(graphiteRetryDelay):
+		return true
+	}
+}
@@ -0,0 +1,238 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	readyOK       = "ready"
+	readyNotReady = "not_ready"
+
+	healthOK        = "ok"
+	healthUnhealthy = "unhealthy"
+	healthFailed    = "failed"
+	healthStale     = "stale"
+)
+
+type pollOutcome struct {
+	time     time.Time
+	err      error
+	breached []string
+	// maxAge is twice the delay until the next poll, see expect
+	maxAge time.Duration
+
+	// the latest successful poll
+	stats     *Stats
+	statsTime time.Time
+	score     *float64
+}
+
+// healthState keeps the last poll outcome of every server, it is written
+// by the pollers and read by the /healthz and /stats handlers.
+type healthState struct {
+	mu sync.Mutex
+	// maxAge is the staleness limit of the polling interval, a server
+	// waiting longer for its next poll gets more
+	maxAge  time.Duration
+	servers map[string]pollOutcome
+}
+
+type statsReport struct {
+	*Stats
+	MemoryUsage  float64   `json:"memory_usage_percent"`
+	DiskUsage    float64   `json:"disk_usage_percent"`
+	NetworkUsage float64   `json:"network_usage_percent"`
+	HealthScore  *float64  `json:"health_score,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+type serverHealth struct {
+	Status   string     `json:"status"`
+	LastPoll *time.Time `json:"last_poll,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Breached []string   `json:"breached,omitempty"`
+}
+
+type healthReport struct {
+	Status  string                  `json:"status"`
+	Servers map[string]serverHealth `json:"servers"`
+}
+
+func newHealthState(servers []string, maxAge time.Duration) *healthState {
+	h := &healthState{
+		maxAge:  maxAge,
+		servers: make(map[string]pollOutcome, len(servers)),
+	}
+	for _, s := range servers {
+		h.servers[s] = pollOutcome{}
+	}
+	return h
+}
+
+// staleAfter is how long a poll outcome is current, two intervals.
+func staleAfter(cfg *Config) time.Duration {
+	return 2 * cfg.PollingInterval
+}
+
+// setMaxAge changes the staleness limit after a reload.
+func (h *healthState) setMaxAge(maxAge time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxAge = maxAge
+}
+
+// expect records the delay until the next poll of server, adaptive
+// polling and Retry-After stretch it past the interval. Its outcome stays
+// current for twice the delay.
+func (h *healthState) expect(server string, wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.servers[server]
+	o.maxAge = 2 * wait
+	h.servers[server] = o
+}
+
+// stale reports whether a poll outcome at t is too old at now.
+func (h *healthState) stale(o pollOutcome, t, now time.Time) bool {
+	return now.Sub(t) > max(h.maxAge, o.maxAge)
+}
+
+func (h *healthState) record(server string, stats *Stats, err error, breached []string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.servers[server]
+	o.time, o.err, o.breached = now, err, breached
+	if err == nil {
+		o.stats, o.statsTime = stats, now
+	}
+	h.servers[server] = o
+}
+
+// recordScore sets the health score reported with the stats of the
+// latest successful poll, nil when no metric counts toward it.
+func (h *healthState) recordScore(server string, score *float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.servers[server]
+	o.score = score
+	h.servers[server] = o
+}
+
+func (h *healthState) report(now time.Time) healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := healthReport{Status: healthOK, Servers: make(map[string]serverHealth, len(h.servers))}
+	for _, server := range sortedKeys(h.servers) {
+		o := h.servers[server]
+		sh := serverHealth{Status: healthOK, Breached: o.breached}
+		if !o.time.IsZero() {
+			sh.LastPoll = &o.time
+		}
+		switch {
+		case o.time.IsZero() || h.stale(o, o.time, now):
+			sh.Status = healthStale
+		case o.err != nil:
+			sh.Status = healthFailed
+			sh.Error = o.err.Error()
+		case len(o.breached) > 0:
+			sh.Status = healthUnhealthy
+		}
+		if sh.Status != healthOK && r.Status == healthOK {
+			r.Status = sh.Status
+		}
+		r.Servers[server] = sh
+	}
+	return r
+}
+
+// ServeHTTP serves /healthz, a liveness probe answering 200 while the
+// process runs. The report only describes the polls, /ready tells whether
+// they succeed.
+func (h *healthState) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.report(time.Now()))
+}
+
+type readyReport struct {
+	Status      string     `json:"status"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// ready reports whether a server had a successful poll within maxAge,
+// telling an orchestrator that the stats are being collected.
+func (h *healthState) ready(now time.Time) readyReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var last time.Time
+	r := readyReport{Status: readyNotReady}
+	for _, o := range h.servers {
+		if o.statsTime.IsZero() {
+			continue
+		}
+		if o.statsTime.After(last) {
+			last = o.statsTime
+		}
+		if !h.stale(o, o.statsTime, now) {
+			r.Status = readyOK
+		}
+	}
+	if !last.IsZero() {
+		r.LastSuccess = &last
+	}
+	return r
+}
+
+func (h *healthState) serveReady(w http.ResponseWriter, _ *http.Request) {
+	r := h.ready(time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Status != readyOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *healthState) serveStats(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	servers := make(map[string]statsReport, len(h.servers))
+	for server, o := range h.servers {
+		if o.stats == nil {
+			continue
+		}
+		servers[server] = statsReport{
+			Stats:        o.stats,
+			MemoryUsage:  o.stats.MemoryUsage(),
+			DiskUsage:    o.stats.DiskUsage(),
+			NetworkUsage: o.stats.NetworkUsage(),
+			HealthScore:  o.score,
+			Timestamp:    o.statsTime,
+		}
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(servers) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "no successful poll yet"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"servers": servers})
+}
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReloadStaleness(t *testing.T) {
+	cfg := testConfig("http://127.0.0.1:1/_stats")
+	cfg.PollingInterval = time.Second
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m.close()
+
+	start := time.Now()
+	m.health.record(cfg.StatsURLs[0], &Stats{}, nil, nil, start)
+	if got := m.health.report(start.Add(3 * time.Second)).Status; got != healthStale {
+		t.Fatalf("status 3s after a poll at a 1s interval = %s, want %s", got, healthStale)
+	}
+
+	reloaded := testConfig(cfg.StatsURLs[0])
+	reloaded.PollingInterval = 5 * time.Second
+	if _, err := m.Reload(reloaded); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := m.health.report(start.Add(3 * time.Second)).Status; got != healthOK {
+		t.Errorf("status 3s after a poll at a reloaded 5s interval = %s, want %s", got, healthOK)
+	}
+}
+
+func TestAdaptiveStaleness(t *testing.T) {
+	cfg := testConfig("http://127.0.0.1:1/_stats")
+	cfg.PollingInterval = time.Second
+	cfg.Adaptive = true
+	cfg.AdaptiveStep = 2 * time.Second
+	cfg.AdaptiveMax = 20 * time.Second
+	server := cfg.StatsURLs[0]
+	h := newHealthState([]string{server}, staleAfter(cfg))
+
+	// a healthy server backs off to the ceiling, it stays current until
+	// well after every next poll is due
+	now, interval := time.Now(), cfg.PollingInterval
+	for i := 0; i < 12; i++ {
+		h.record(server, &Stats{}, nil, nil, now)
+		interval = adapt(cfg, interval, true)
+		h.expect(server, interval)
+		due := now.Add(interval + interval/2)
+		if got := h.report(due).Status; got != healthOK {
+			t.Fatalf("poll %d, interval %v: health = %s, want %s", i, interval, got, healthOK)
+		}
+		if got := h.ready(due).Status; got != readyOK {
+			t.Fatalf("poll %d, interval %v: ready = %s, want %s", i, interval, got, readyOK)
+		}
+		now = now.Add(interval)
+	}
+	if interval != cfg.AdaptiveMax {
+		t.Fatalf("interval = %v, want the %v ceiling", interval, cfg.AdaptiveMax)
+	}
+
+	// a missed poll still goes stale
+	late := now.Add(2*interval + time.Second)
+	if got := h.report(late).Status; got != healthStale {
+		t.Errorf("health after a missed poll = %s, want %s", got, healthStale)
+	}
+	if got := h.ready(late).Status; got != readyNotReady {
+		t.Errorf("ready after a missed poll = %s, want %s", got, readyNotReady)
+	}
+}
+
+func TestRetryAfterStaleness(t *testing.T) {
+	server := "http://127.0.0.1:1/_stats"
+	h := newHealthState([]string{server}, 2*time.Second)
+	now := time.Now()
+	h.record(server, &Stats{}, nil, nil, now)
+	h.expect(server, time.Hour)
+	if got := h.ready(now.Add(30 * time.Minute)).Status; got != readyOK {
+		t.Errorf("ready while waiting for a Retry-After delay = %s, want %s", got, readyOK)
+	}
+}
+
+func TestServeHealthz(t *testing.T) {
+	server := "http://127.0.0.1:1/_stats"
+	now := time.Now()
+	tests := []struct {
+		name   string
+		record func(h *healthState)
+		health string
+		ready  int
+	}{
+		{"no poll yet", func(*healthState) {}, healthStale, http.StatusServiceUnavailable},
+		{"healthy", func(h *healthState) { h.record(server, &Stats{}, nil, nil, now) }, healthOK, http.StatusOK},
+		{"breached", func(h *healthState) { h.record(server, &Stats{}, nil, []string{metricLoadAverage}, now) }, healthUnhealthy, http.StatusOK},
+		{"failed", func(h *healthState) { h.record(server, nil, ErrBadStatus, nil, now) }, healthFailed, http.StatusServiceUnavailable},
+		{"stale", func(h *healthState) { h.record(server, &Stats{}, nil, nil, now.Add(-time.Hour)) }, healthStale, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHealthState([]string{server}, time.Minute)
+			tt.record(h)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("/healthz status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			var report healthReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("unmarshal %q: %v", rec.Body.String(), err)
+			}
+			if report.Status != tt.health {
+				t.Errorf("/healthz report status = %s, want %s", report.Status, tt.health)
+			}
+
+			rec = httptest.NewRecorder()
+			h.serveReady(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.ready {
+				t.Errorf("/ready status = %d, want %d", rec.Code, tt.ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// influxMeasurement is the measurement of the written points
+	influxMeasurement = "stat_loader"
+	// points are sent once this many are buffered or influxFlushInterval
+	// has passed since the last write
+	influxBatchSize     = 100
+	influxFlushInterval = 10 * time.Second
+)
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxWriter writes stats points to the InfluxDB v2 write API in the
+// line protocol, batched when polls come faster than the flush interval.
+type influxWriter struct {
+	client *http.Client
+	url    string
+	token  string
+
+	mu      sync.Mutex
+	points  []string
+	flushed time.Time
+}
+
+func newInfluxWriter(cfg *Config) *influxWriter {
+	q := url.Values{"org": {cfg.InfluxOrg}, "bucket": {cfg.InfluxBucket}, "precision": {"ns"}}
+	return &influxWriter{
+		client: &http.Client{Timeout: cfg.HTTPTimeout},
+		url:    strings.TrimSuffix(cfg.InfluxURL, "/") + "/api/v2/write?" + q.Encode(),
+		token:  cfg.InfluxToken,
+	}
+}
+
+// write buffers a point of server stats and sends the batch when it is
+// full or the last write is old enough.
+func (w *influxWriter) write(ctx context.Context, server string, stats *Stats, now time.Time) {
+	// every value is a float field, the stats may be fractional
+	point := fmt.Sprintf("%s,server=%s load_average=%g,memory_total=%g,memory_used=%g,memory_usage=%g,"+
+		"disk_total=%g,disk_used=%g,disk_usage=%g,network_capacity=%g,network_used=%g,network_usage=%g %d",
+		influxMeasurement, influxTagEscaper.Replace(server), stats.LoadAverage,
+		stats.MemoryTotal, stats.MemoryUsed, stats.MemoryUsage(),
+		stats.DiskTotal, stats.DiskUsed, stats.DiskUsage(),
+		stats.NetworkCapacity, stats.NetworkUsed, stats.NetworkUsage(), now.UnixNano())
+
+	w.mu.Lock()
+	w.points = append(w.points, point)
+	due := len(w.points) >= influxBatchSize || now.Sub(w.flushed) >= influxFlushInterval
+	if due {
+		w.flushed = now
+	}
+	w.mu.Unlock()
+
+	if due {
+		w.flush(ctx)
+	}
+}
+
+// flush sends the buffered points, they are dropped on failure.
+func (w *influxWriter) flush(ctx context.Context) {
+	w.mu.Lock()
+	points := w.points
+	w.points = nil
+	w.mu.Unlock()
+	if len(points) == 0 {
+		return
+	}
+
+	header := http.Header{
+		"Authorization": {"Token " + w.token},
+		"Content-Type":  {"text/plain; charset=utf-8"},
+	}
+	if err := post(ctx, w.client, w.url, header, []byte(strings.Join(points, "\n"))); err != nil {
+		slog.Error("Unable to write points to InfluxDB.", "points", len(points), "error", err)
+	}
+}
+
+// close sends the points left in the buffer, waiting up to timeout.
+func (w *influxWriter) close(timeout time.Duration) {
+	if w == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	w.flush(ctx)
+}
@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInfluxWrite(t *testing.T) {
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig("http://127.0.0.1:1/_stats")
+	cfg.InfluxURL = srv.URL
+	w := newInfluxWriter(cfg)
+	now := time.Unix(1700000000, 0)
+	// the first write is due right away, nothing was flushed before
+	w.write(context.Background(), "srv 1", &Stats{1.75, 100, 12.5, 1000, 500, 1000, 250.5, 0}, now)
+
+	want := "stat_loader,server=srv\\ 1 load_average=1.75,memory_total=100,memory_used=12.5,memory_usage=12.5," +
+		"disk_total=1000,disk_used=500,disk_usage=50,network_capacity=1000,network_used=250.5,network_usage=25.05 1700000000000000000"
+	select {
+	case got := <-bodies:
+		if got != want {
+			t.Errorf("point = %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no point written")
+	}
+}
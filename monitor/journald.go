@@ -0,0 +1,147 @@
+//go:build linux
+
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// syslog priorities of the journal PRIORITY field
+const (
+	journalCrit    = 2
+	journalErr     = 3
+	journalWarning = 4
+	journalInfo    = 6
+	journalDebug   = 7
+)
+
+// journalHandler writes records to the systemd journal in its native
+// protocol, one datagram per record. The attributes become upper case
+// fields, so alerts carry METRIC, VALUE, THRESHOLD and SEVERITY.
+type journalHandler struct {
+	conn  *net.UnixConn
+	level slog.Level
+	// attrs are the fields added with WithAttrs, prefix the group names
+	attrs  []byte
+	prefix string
+}
+
+func newJournalHandler(level slog.Level) (slog.Handler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("journald: %w", err)
+	}
+	return &journalHandler{conn: conn, level: level}, nil
+}
+
+func (h *journalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *journalHandler) Handle(_ context.Context, r slog.Record) error {
+	priority, critical := journalInfo, false
+	var fields []byte
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "severity" && a.Value.String() == severityCritical {
+			critical = true
+		}
+		fields = appendJournalAttr(fields, h.prefix, a)
+		return true
+	})
+	switch {
+	case r.Level >= slog.LevelError && critical:
+		priority = journalCrit
+	case r.Level >= slog.LevelError:
+		priority = journalErr
+	case r.Level >= slog.LevelWarn:
+		priority = journalWarning
+	case r.Level < slog.LevelInfo:
+		priority = journalDebug
+	}
+
+	var b []byte
+	b = appendJournalField(b, "MESSAGE", r.Message)
+	b = appendJournalField(b, "PRIORITY", strconv.Itoa(priority))
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", syslogTag)
+	b = append(b, h.attrs...)
+	b = append(b, fields...)
+	_, err := h.conn.Write(b)
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]byte(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = appendJournalAttr(c.attrs, h.prefix, a)
+	}
+	return &c
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.prefix = h.prefix + name + "_"
+	return &c
+}
+
+func appendJournalAttr(b []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "_"
+		}
+		for _, g := range a.Value.Group() {
+			b = appendJournalAttr(b, prefix, g)
+		}
+		return b
+	}
+	key := journalFieldName(prefix + a.Key)
+	if key == "" {
+		return b
+	}
+	return appendJournalField(b, key, a.Value.String())
+}
+
+// journalFieldName turns key into a journal field name: upper case
+// letters, digits and underscores, not starting with an underscore, which
+// is reserved, or a digit, at most 64 long. It is empty when nothing is
+// left.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// appendJournalField appends a KEY=value line, or the binary form with
+// the value length when the value has a newline.
+func appendJournalField(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package monitor
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+)
+
+// newJournalHandler fails, there is no journal on this platform.
+func newJournalHandler(slog.Level) (slog.Handler, error) {
+	return nil, fmt.Errorf("journald: not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,221 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// -log-output destinations
+const (
+	logOutputStdout   = "stdout"
+	logOutputJournald = "journald"
+)
+
+// -color modes
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ansi colors of text log lines by level
+const (
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+	ansiReset  = "\x1b[0m"
+)
+
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// NewLogOutput returns the log destination, with -log-file set logs go to
+// a size-rotated file and are optionally echoed to stdout.
+func NewLogOutput(cfg *Config) (io.Writer, func() error) {
+	if cfg.LogFile == "" {
+		return os.Stdout, func() error { return nil }
+	}
+
+	file := &lumberjack.Logger{
+		Filename:   cfg.LogFile,
+		MaxSize:    cfg.LogMaxSize,
+		MaxBackups: cfg.LogMaxBackups,
+	}
+	if cfg.LogEcho {
+		return &echoWriter{term: os.Stdout, file: file}, file.Close
+	}
+	return file, file.Close
+}
+
+// echoWriter writes the log to a file and echoes it to stdout. Colored
+// text lines only go to stdout, the file gets them plain.
+type echoWriter struct {
+	term io.Writer
+	file io.Writer
+}
+
+func (w *echoWriter) Write(p []byte) (int, error) {
+	if _, err := w.term.Write(p); err != nil {
+		return 0, err
+	}
+	return w.file.Write(p)
+}
+
+// logClock stamps log records in loc, now replaces the record time
+// when set so the output can be pinned to a fixed clock.
+type logClock struct {
+	now func() time.Time
+	loc *time.Location
+	// prefix text lines with the time
+	prefix bool
+}
+
+func (c logClock) stamp(t time.Time) time.Time {
+	if c.now != nil {
+		t = c.now()
+	}
+	return t.In(c.loc)
+}
+
+// useColor reports whether text logs echoed to stdout are colored, in
+// auto mode only when they go straight to a terminal. The log file is
+// never colored.
+func useColor(cfg *Config) bool {
+	switch cfg.Color {
+	case colorAlways:
+		return cfg.LogFormat == logFormatText && (cfg.LogFile == "" || cfg.LogEcho)
+	case colorAuto:
+		return cfg.LogFormat == logFormatText && cfg.LogFile == "" && term.IsTerminal(int(os.Stdout.Fd()))
+	}
+	return false
+}
+
+// NewLogger returns a logger writing to w in the configured format,
+// level and time zone. With -log-output journald it writes to the
+// journal instead, and falls back to w when there is none.
+func NewLogger(cfg *Config, w io.Writer) *slog.Logger {
+	level, _ := parseLogLevel(cfg.LogLevel)
+	if cfg.LogOutput == logOutputJournald {
+		h, err := newJournalHandler(level)
+		if err == nil {
+			return slog.New(h)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v, logging to stdout instead\n", err)
+	}
+	loc, _ := time.LoadLocation(cfg.TZ)
+	return newLogger(cfg.LogFormat, level, w, logClock{loc: loc, prefix: cfg.Timestamps}, useColor(cfg))
+}
+
+func newLogger(format string, level slog.Level, w io.Writer, clock logClock, color bool) *slog.Logger {
+	if format == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					a = slog.Time("timestamp", clock.stamp(a.Value.Time()))
+				}
+				return a
+			},
+		}))
+	}
+	h := &plainHandler{mu: &sync.Mutex{}, w: w, level: level, clock: clock}
+	if color {
+		h.w, h.term = nil, w
+		if e, ok := w.(*echoWriter); ok {
+			h.w, h.term = e.file, e.term
+		}
+	}
+	return slog.New(h)
+}
+
+// bareKey marks the context of records the text log prints without
+// their attributes.
+type bareKey struct{}
+
+// bare marks the records logged with ctx as complete in their message:
+// the alert and fetch error lines the autotest matches, and the lines
+// spelling out their attributes.
+func bare(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bareKey{}, true)
+}
+
+// plainHandler prints messages one per line followed by their attributes
+// as key=value. Bare records print the message alone, keeping the
+// interactive output the same as it was before structured logging.
+type plainHandler struct {
+	mu *sync.Mutex
+	// w gets plain lines and term colored ones, either may be nil
+	w     io.Writer
+	term  io.Writer
+	level slog.Level
+	clock logClock
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(ctx context.Context, r slog.Record) error {
+	line := r.Message
+	if ctx.Value(bareKey{}) == nil {
+		r.Attrs(func(a slog.Attr) bool {
+			line += " " + formatAttr(a)
+			return true
+		})
+	}
+	colored := line
+	switch {
+	case r.Level >= slog.LevelError:
+		colored = ansiRed + line + ansiReset
+	case r.Level >= slog.LevelWarn:
+		colored = ansiYellow + line + ansiReset
+	}
+	if h.clock.prefix {
+		prefix := h.clock.stamp(r.Time).Format(time.RFC3339) + " "
+		line, colored = prefix+line, prefix+colored
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.term != nil {
+		if _, err := fmt.Fprintln(h.term, colored); err != nil {
+			return err
+		}
+	}
+	if h.w != nil {
+		_, err := fmt.Fprintln(h.w, line)
+		return err
+	}
+	return nil
+}
+
+// formatAttr formats a as key=value, quoting a value that is empty or
+// would not read as one.
+func formatAttr(a slog.Attr) string {
+	v := a.Value.Resolve().String()
+	if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+		v = strconv.Quote(v)
+	}
+	return a.Key + "=" + v
+}
+
+func (h *plainHandler) WithAttrs(_ []slog.Attr) slog.Handler { return h }
+
+func (h *plainHandler) WithGroup(_ string) slog.Handler { return h }
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLoggerTimestamps(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	clock := newFakeClock()
+	tests := []struct {
+		name   string
+		format string
+		prefix bool
+		want   string
+	}{
+		{"text", logFormatText, false, "Memory usage too high: 90%\n"},
+		{"text with timestamps", logFormatText, true, "2024-01-01T03:00:00+03:00 Memory usage too high: 90%\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newLogger(tt.format, slog.LevelInfo, &buf, logClock{now: clock.now, loc: loc, prefix: tt.prefix}, false)
+			logger.ErrorContext(bare(context.Background()), "Memory usage too high: 90%", "metric", metricMemoryUsage)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("line = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := newLogger(logFormatJSON, slog.LevelInfo, &buf, logClock{now: clock.now, loc: loc}, false)
+		logger.Error("Memory usage too high: 90%", "metric", metricMemoryUsage)
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("unmarshal %q: %v", buf.String(), err)
+		}
+		if got, want := record["timestamp"], "2024-01-01T03:00:00+03:00"; got != want {
+			t.Errorf("timestamp = %v, want %v", got, want)
+		}
+		if _, ok := record[slog.TimeKey]; ok {
+			t.Errorf("record has a %q field next to the timestamp", slog.TimeKey)
+		}
+	})
+}
+
+func TestPlainHandlerAttrs(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want string
+	}{
+		{
+			name: "diagnostic",
+			log: func(l *slog.Logger) {
+				l.Error("HTTP server failed.", "addr", ":9090", "error", errors.New("listen tcp :9090: bind: address already in use"))
+			},
+			want: "HTTP server failed. addr=:9090 error=\"listen tcp :9090: bind: address already in use\"\n",
+		},
+		{
+			name: "list and empty values",
+			log: func(l *slog.Logger) {
+				l.Warn("Config changes require a restart and were ignored.", "settings", []string{"health-addr", "log-file"}, "note", "")
+			},
+			want: "Config changes require a restart and were ignored. settings=\"[health-addr log-file]\" note=\"\"\n",
+		},
+		{
+			name: "no attributes",
+			log:  func(l *slog.Logger) { l.Info("Config reloaded.") },
+			want: "Config reloaded.\n",
+		},
+		{
+			name: "alert",
+			log: func(l *slog.Logger) {
+				l.ErrorContext(bare(context.Background()), "Load Average is too high: 45", "metric", metricLoadAverage, "value", 45)
+			},
+			want: "Load Average is too high: 45\n",
+		},
+		{
+			name: "fetch error",
+			log: func(l *slog.Logger) {
+				l.ErrorContext(bare(context.Background()), "Unable to fetch server statistic.", "server", "http://127.0.0.1/_stats", "error", ErrBadStatus)
+			},
+			want: "Unable to fetch server statistic.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(newLogger(logFormatText, slog.LevelInfo, &buf, logClock{loc: time.UTC}, false))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("line = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogColor(t *testing.T) {
+	var term, file bytes.Buffer
+	logger := newLogger(logFormatText, slog.LevelInfo, &echoWriter{term: &term, file: &file}, logClock{loc: time.UTC}, true)
+	logger.ErrorContext(bare(context.Background()), "Memory usage too high: 90%")
+	logger.Info("Config reloaded.")
+	if got, want := term.String(), ansiRed+"Memory usage too high: 90%"+ansiReset+"\nConfig reloaded.\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := file.String(), "Memory usage too high: 90%\nConfig reloaded.\n"; got != want {
+		t.Errorf("log file = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		logFile string
+		echo    bool
+		format  string
+		want    bool
+	}{
+		{"stdout", "", false, logFormatText, true},
+		{"json", "", false, logFormatJSON, false},
+		{"log file", "monitor.log", false, logFormatText, false},
+		{"log file echoed", "monitor.log", true, logFormatText, true},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Color, cfg.LogFile, cfg.LogEcho, cfg.LogFormat = colorAlways, tt.logFile, tt.echo, tt.format
+		if got := useColor(&cfg); got != tt.want {
+			t.Errorf("%s: useColor with -color always = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// clockLayout is the time of day format of daily maintenance windows.
+const clockLayout = "15:04"
+
+// MaintenanceWindow is a period when alerts are evaluated but not sent.
+// Daily windows repeat every day between "15:04" local clock times and
+// may cross midnight, the others are a single period between RFC 3339
+// times.
+type MaintenanceWindow struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	Daily bool   `yaml:"daily"`
+}
+
+func (w MaintenanceWindow) contains(now time.Time) (bool, error) {
+	if w.Daily {
+		start, err := time.Parse(clockLayout, w.Start)
+		if err != nil {
+			return false, fmt.Errorf("invalid maintenance start %q: %w", w.Start, err)
+		}
+		end, err := time.Parse(clockLayout, w.End)
+		if err != nil {
+			return false, fmt.Errorf("invalid maintenance end %q: %w", w.End, err)
+		}
+
+		from := start.Hour()*60 + start.Minute()
+		to := end.Hour()*60 + end.Minute()
+		cur := now.Hour()*60 + now.Minute()
+		if from <= to {
+			return from <= cur && cur < to, nil
+		}
+		return cur >= from || cur < to, nil
+	}
+
+	start, err := time.Parse(time.RFC3339, w.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance start %q: %w", w.Start, err)
+	}
+	end, err := time.Parse(time.RFC3339, w.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance end %q: %w", w.End, err)
+	}
+	if !end.After(start) {
+		return false, fmt.Errorf("invalid maintenance window %s - %s: end must be after start", w.Start, w.End)
+	}
+	return !now.Before(start) && now.Before(end), nil
+}
+
+// inMaintenance reports whether alerts are suppressed at now. The config
+// is validated, so the windows parse.
+func (c *Config) inMaintenance(now time.Time) bool {
+	if c.MaintenanceUntil != "" {
+		until, _ := time.Parse(time.RFC3339, c.MaintenanceUntil)
+		if now.Before(until) {
+			return true
+		}
+	}
+	for _, w := range c.Maintenance {
+		if ok, _ := w.contains(now); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "stat_loader"
+
+var (
+	loadAverageGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "load_average",
+		Help:      "Load average reported by the server.",
+	}, []string{"server"})
+	memoryUsedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "memory_used_bytes",
+		Help:      "Used memory reported by the server.",
+	}, []string{"server"})
+	memoryTotalGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "memory_total_bytes",
+		Help:      "Total memory reported by the server.",
+	}, []string{"server"})
+	diskUsedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "disk_used_bytes",
+		Help:      "Used disk space reported by the server.",
+	}, []string{"server"})
+	diskTotalGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "disk_total_bytes",
+		Help:      "Total disk space reported by the server.",
+	}, []string{"server"})
+	networkUsedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "network_used_bytes_per_second",
+		Help:      "Used network bandwidth reported by the server.",
+	}, []string{"server"})
+	networkCapacityGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "network_capacity_bytes_per_second",
+		Help:      "Network bandwidth capacity reported by the server.",
+	}, []string{"server"})
+	healthScoreGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "health_score",
+		Help:      "Composite 0-100 health score of the server metrics, 100 being idle.",
+	}, []string{"server"})
+	fetchDurationHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Time taken to fetch the stats of the server, retries and failover included.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server"})
+	pollsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "polls_total",
+		Help:      "Number of polls by result: success, fetch_failure or parse_failure.",
+	}, []string{"server", "result"})
+	pollFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "poll_failures_total",
+		Help:      "Number of polls that failed to fetch or parse server statistic.",
+	}, []string{"server"})
+	invalidStatsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "invalid_stats_total",
+		Help:      "Number of fetched stats rejected as invalid, by reason.",
+	}, []string{"server", "reason"})
+)
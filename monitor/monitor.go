@@ -0,0 +1,1116 @@
+// Package monitor polls server stats endpoints and alerts when the load,
+// memory, disk or network usage crosses the configured thresholds.
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// default settings
+	statsURL        = "http://srv.msk01.gigacorp.local/_stats"
+	pollingInterval = 5 * time.Second
+	httpTimeout     = 30 * time.Second
+	retryAttempts   = 1
+	retryBackoff    = 500 * time.Millisecond
+	breakerCooldown = time.Minute
+	maxRetryAfter   = time.Hour
+	maxRedirects    = 10
+	shutdownTimeout = 10 * time.Second
+	metricsAddr     = ":9090"
+	statsdPrefix    = "stat_loader"
+	syslogNetwork   = "udp"
+	logMaxSize      = 100
+	logMaxBackups   = 3
+
+	// default adaptive polling settings
+	adaptiveMin  = time.Second
+	adaptiveMax  = time.Minute
+	adaptiveStep = time.Second
+
+	// -count-mode values
+	countTotal      = "total"
+	countSuccessful = "successful"
+
+	// load thresholds modes
+	loadModeAbsolute = "absolute"
+	loadModePerCore  = "per-core"
+
+	// default alerting settings
+	hysteresisBand = 5
+	leakPolls      = 10
+	leakDelta      = 5
+
+	// default task settings
+	loadAverageThreshold      = 30
+	memoryUsageThreshold      = 80
+	freeDiscSpaceThreshold    = 90
+	networkBandwidthThreshold = 90
+)
+
+// poll outcomes, RunOnce returns the worst one as the exit code
+const (
+	ExitHealthy   = 0
+	ExitUnhealthy = 1
+	ExitFailed    = 2
+)
+
+// Monitor polls the configured servers and alerts on threshold breaches.
+// It logs through the default slog logger.
+type Monitor struct {
+	cfg    *atomic.Pointer[Config]
+	client *http.Client
+	extra  []Notifier
+	notify notifiers
+	// escalation holds the escalation targets by notifier name
+	escalation map[string]Notifier
+	events     *eventStream
+	pollers    []*poller
+	health     *healthState
+	summary    *runSummary
+	statsd     *statsdClient
+	graphite   *graphiteWriter
+	influx     *influxWriter
+	otel       *otelMetrics
+	ran        atomic.Bool
+}
+
+// Option customizes a Monitor.
+type Option func(*Monitor)
+
+// WithHTTPClient polls the stats endpoints with client instead of
+// one built from the timeout and TLS settings.
+func WithHTTPClient(client *http.Client) Option {
+	return func(m *Monitor) { m.client = client }
+}
+
+// WithNotifier sends alerts to n in addition to the configured notifiers.
+func WithNotifier(n Notifier) Option {
+	return func(m *Monitor) { m.extra = append(m.extra, n) }
+}
+
+// WithEventBuffer sets the capacity of the Events channel.
+func WithEventBuffer(size int) Option {
+	return func(m *Monitor) { m.events = newEventStream(max(size, 0)) }
+}
+
+// WithOnAlert calls fn on every breach alert. The callbacks run
+// synchronously on the goroutine polling the alerting server, so the next
+// poll of that server waits for them. Servers are polled concurrently, a
+// callback shared between them has to be safe for concurrent use.
+func WithOnAlert(fn func(Alert)) Option {
+	return WithNotifier(callbackNotifier{onAlert: fn})
+}
+
+// WithOnRecover calls fn on every recovery, even with recovery
+// notifications off. It runs the same way as the WithOnAlert callback.
+func WithOnRecover(fn func(Alert)) Option {
+	return WithNotifier(callbackNotifier{onRecover: fn})
+}
+
+// New validates cfg and sets up a Monitor for it. The outputs it opens
+// are released when Run or RunOnce returns.
+func New(cfg *Config, opts ...Option) (*Monitor, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Banner {
+		cfg.logBanner()
+	}
+	m := &Monitor{cfg: &atomic.Pointer[Config]{}, events: newEventStream(eventBufferSize)}
+	m.cfg.Store(cfg)
+	for _, opt := range opts {
+		opt(m)
+	}
+	// a failed step closes the notifiers and writers set up before it
+	built := false
+	defer func() {
+		if !built {
+			m.close()
+		}
+	}()
+
+	ns, escalation, err := newNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.notify, m.escalation = ns, escalation
+	notifier := append(ns, m.extra...)
+	notifier = append(notifier, eventNotifier{events: m.events})
+
+	header, err := parseHeaders(cfg.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// init http client
+	if m.client == nil {
+		transport, err := newTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+		m.client = &http.Client{Timeout: cfg.HTTPTimeout, Transport: transport, CheckRedirect: checkRedirect(cfg.MaxRedirects)}
+	}
+
+	servers := cfg.servers()
+	var source *fileSource
+	if cfg.Source != "" {
+		source, err = newFileSource(cfg.Source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.StatsdAddr != "" {
+		m.statsd, err = newStatsdClient(cfg.StatsdAddr, cfg.StatsdPrefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.GraphiteAddr != "" {
+		m.graphite = newGraphiteWriter(cfg.GraphiteAddr, cfg.GraphitePrefix)
+	}
+	if cfg.InfluxURL != "" {
+		m.influx = newInfluxWriter(cfg)
+	}
+	if cfg.OTLPEndpoint != "" {
+		m.otel, err = newOtelMetrics(context.Background(), cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.health = newHealthState(servers, staleAfter(cfg))
+	m.summary = newRunSummary()
+	var store *stateStore
+	if cfg.StateFile != "" {
+		store = loadStateStore(cfg.StateFile)
+	}
+
+	// init pollers, one per server
+	for _, u := range servers {
+		statsdHost := ""
+		if len(servers) > 1 {
+			statsdHost = statsdHostName(u)
+		}
+		state := newAlertState()
+		if store != nil {
+			state.restore(store.get(u))
+		}
+		endpoints := []string{u}
+		if cfg.Failover && source == nil {
+			endpoints = cfg.StatsURLs
+		}
+		p := &poller{
+			client:     m.client,
+			source:     source,
+			cfg:        m.cfg,
+			notifier:   notifier,
+			escalation: m.escalation,
+			parts:      make(map[string]scorePart),
+			evaluated:  make(map[string]time.Time),
+			state:      state,
+			store:      store,
+			statsd:     m.statsd,
+			graphite:   m.graphite,
+			statsdHost: statsdHost,
+			influx:     m.influx,
+			otel:       m.otel,
+			health:     m.health,
+			summary:    m.summary,
+			events:     m.events,
+			url:        u,
+			endpoints:  endpoints,
+			active:     u,
+			header:     header,
+		}
+		p.last.Store(ExitFailed)
+		m.pollers = append(m.pollers, p)
+	}
+	built = true
+	return m, nil
+}
+
+// Events streams the poll results, alerts and recoveries. Events are
+// dropped while the channel buffer is full, so a slow consumer loses
+// events instead of delaying the polls. The channel is closed when Run
+// or RunOnce returns.
+func (m *Monitor) Events() <-chan Event {
+	return m.events.ch
+}
+
+// Reload validates cfg and makes it the active configuration from the
+// next poll on. Startup-only settings keep their previous values, their
+// names are returned if cfg changed them.
+func (m *Monitor) Reload(cfg *Config) ([]string, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	ignored := cfg.keepStatic(m.cfg.Load())
+	m.cfg.Store(cfg)
+	m.health.setMaxAge(staleAfter(cfg))
+	return ignored, nil
+}
+
+// RunOnce polls every server a single time and returns the exit code
+// of the worst outcome. It is ExitFailed on a Monitor that already ran.
+func (m *Monitor) RunOnce(ctx context.Context) int {
+	if m.ran.Swap(true) {
+		slog.Error("Unable to poll.", "error", ErrClosed)
+		return ExitFailed
+	}
+	code := runOnce(ctx, m.pollers)
+	m.close()
+
+	if !m.cfg.Load().NoSummary {
+		m.summary.log()
+	}
+	return code
+}
+
+// ExitCode is the worst outcome of the last poll of every server, a
+// server that wasn't polled yet counts as failed.
+func (m *Monitor) ExitCode() int {
+	code := ExitHealthy
+	for _, p := range m.pollers {
+		code = max(code, int(p.last.Load()))
+	}
+	return code
+}
+
+// Run polls the servers and serves the metrics and health endpoints
+// until ctx is cancelled or every server got Count polls, then waits up
+// to the shutdown timeout for the polls in flight and releases the
+// outputs. A Monitor runs once, later calls return ErrClosed.
+//
+// Run returns nil on a clean shutdown, a cancelled ctx included. The only
+// fatal error is ErrTooManyFailures, wrapped with the server URL, when a
+// server fails more than MaxFailures polls in a row. Everything else is
+// recoverable and only logged: failed fetches and bad stats bodies count
+// towards MaxFailures, failed notifications are retried as configured and
+// an HTTP endpoint that can't listen leaves the polls running.
+func (m *Monitor) Run(ctx context.Context) error {
+	if m.ran.Swap(true) {
+		return ErrClosed
+	}
+	cfg := m.cfg.Load()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// polls in flight at shutdown get a separate context, it is only
+	// cancelled once the shutdown timeout runs out
+	pollCtx, forceStop := context.WithCancel(context.Background())
+	defer forceStop()
+
+	var wg sync.WaitGroup
+
+	// init metrics and health servers
+	srvRoutes := routes{}
+	srvRoutes.handle(cfg.MetricsAddr, "/metrics", promhttp.Handler())
+	srvRoutes.handle(cfg.HealthAddr, "/healthz", m.health)
+	srvRoutes.handle(cfg.HealthAddr, "/ready", http.HandlerFunc(m.health.serveReady))
+	statsAddr := cfg.MetricsAddr
+	if statsAddr == "" {
+		statsAddr = cfg.HealthAddr
+	}
+	srvRoutes.handle(statsAddr, "/stats", http.HandlerFunc(m.health.serveStats))
+	for addr, mux := range srvRoutes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveHTTP(ctx, addr, mux)
+		}()
+	}
+
+	var polling sync.WaitGroup
+	for _, p := range m.pollers {
+		wg.Add(1)
+		polling.Add(1)
+		go func() {
+			defer wg.Done()
+			defer polling.Done()
+			if err := p.run(pollCtx, ctx.Done()); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	// with a poll count the run ends once every server got its polls
+	go func() {
+		polling.Wait()
+		cancel(nil)
+	}()
+
+	<-ctx.Done()
+	// the timeout may have been reloaded since the start
+	timeout := m.cfg.Load().ShutdownTimeout
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Shutdown complete.", "forced", false)
+	case <-time.After(timeout):
+		forceStop()
+		slog.Warn("Shutdown timed out, active polls aborted.", "forced", true, "timeout", timeout.String())
+	}
+	m.close()
+
+	if !m.cfg.Load().NoSummary {
+		m.summary.log()
+	}
+
+	if err := context.Cause(ctx); errors.Is(err, ErrTooManyFailures) {
+		return err
+	}
+	return nil
+}
+
+// close flushes and releases the outputs and ends the event stream.
+func (m *Monitor) close() {
+	m.events.close()
+	m.notify.close()
+	var escalation notifiers
+	for _, n := range m.escalation {
+		escalation = append(escalation, n)
+	}
+	escalation.close()
+	m.influx.close(m.cfg.Load().HTTPTimeout)
+	shutdownOtel(m.otel)
+	m.statsd.Close()
+	m.graphite.close(m.cfg.Load().HTTPTimeout)
+}
+
+func shutdownOtel(m *otelMetrics) {
+	if err := m.shutdown(); err != nil {
+		slog.Error("Unable to export OpenTelemetry metrics.", "error", err)
+	}
+}
+
+// runOnce polls every server a single time and returns the exit code
+// of the worst outcome.
+func runOnce(ctx context.Context, pollers []*poller) int {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		code = ExitHealthy
+	)
+	for _, p := range pollers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rc := p.poll(ctx)
+			mu.Lock()
+			code = max(code, rc)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return code
+}
+
+type poller struct {
+	client   *http.Client
+	source   *fileSource
+	cfg      *atomic.Pointer[Config]
+	notifier Notifier
+	// escalation holds the escalation targets by notifier name
+	escalation map[string]Notifier
+	state      *alertState
+	store      *stateStore
+	statsd     *statsdClient
+	// statsdHost names the server in StatsD and Graphite metrics
+	statsdHost string
+	graphite   *graphiteWriter
+	// score is the health score of the latest evaluated stats, from the
+	// parts of the metrics as last evaluated
+	score *float64
+	parts map[string]scorePart
+	// evaluated is when the metrics with their own interval were last
+	// evaluated
+	evaluated map[string]time.Time
+	// latency is how long the latest fetch took
+	latency time.Duration
+	influx  *influxWriter
+	otel    *otelMetrics
+	health  *healthState
+	summary *runSummary
+	events  *eventStream
+	breaker circuitBreaker
+	// failures counts the consecutive failed polls
+	failures int
+	// polls counts the polls toward the poll count
+	polls int
+	// last is the outcome of the last poll
+	last atomic.Int64
+	// notBefore delays the next poll as asked by a Retry-After header
+	notBefore time.Time
+	url       string
+	// endpoints are the failover URLs of the server, tried in order
+	endpoints []string
+	// active is the endpoint that answered last
+	active string
+	header http.Header
+}
+
+// run polls the server every interval until stop is closed. The timer
+// is reset after every poll so a reload, jitter or adaptive polling
+// changes the next wait.
+func (p *poller) run(ctx context.Context, stop <-chan struct{}) error {
+	// init timer
+	interval := p.cfg.Load().PollingInterval
+	wait := withJitter(p.cfg.Load(), interval)
+	p.health.expect(p.url, wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-timer.C:
+			cfg := p.cfg.Load()
+			code := ExitFailed
+			// an open circuit breaker skips the poll
+			if p.breaker.allow(time.Now()) {
+				code = p.poll(ctx)
+				p.last.Store(int64(code))
+				if cfg.CountMode == countTotal || code == ExitHealthy || code == ExitUnhealthy {
+					p.polls++
+				}
+			}
+			cfg = p.cfg.Load()
+			if cfg.MaxFailures > 0 && p.failures > cfg.MaxFailures {
+				slog.Error(p.tag(cfg, fmt.Sprintf("Giving up after %d consecutive poll failures.", p.failures)), "server", p.url, "failures", p.failures)
+				return fmt.Errorf("%s: %w", p.url, ErrTooManyFailures)
+			}
+			if cfg.Count > 0 && p.polls >= cfg.Count {
+				return nil
+			}
+			healthy := code == ExitHealthy
+			interval = adapt(cfg, interval, healthy)
+			wait := withJitter(cfg, interval)
+			// the server asked to come back later
+			if until := time.Until(p.notBefore); until > wait {
+				wait = until
+			}
+			p.health.expect(p.url, wait)
+			timer.Reset(wait)
+		}
+	}
+}
+
+// adapt moves the interval a step toward the floor after an unhealthy
+// poll and toward the ceiling after a healthy one. It stays within both,
+// so an interval left out of them by a reload is brought back at once.
+func adapt(cfg *Config, interval time.Duration, healthy bool) time.Duration {
+	if !cfg.Adaptive {
+		return cfg.PollingInterval
+	}
+	if healthy {
+		interval += cfg.AdaptiveStep
+	} else {
+		interval -= cfg.AdaptiveStep
+	}
+	return min(max(interval, cfg.AdaptiveMin), cfg.AdaptiveMax)
+}
+
+// withJitter randomizes d by the configured jitter.
+func withJitter(cfg *Config, d time.Duration) time.Duration {
+	if cfg.Jitter == 0 {
+		return d
+	}
+	spread := float64(d) * float64(cfg.Jitter) / 100
+	j := d + time.Duration(spread*(2*rand.Float64()-1))
+	if j <= 0 {
+		return d
+	}
+	return j
+}
+
+// poll runs a single poll, logs its failure and returns the health
+// of the server as an exit code.
+func (p *poller) poll(ctx context.Context) int {
+	cfg := p.cfg.Load()
+	stats, err := p.pollOnce(ctx, cfg)
+	if err == nil {
+		err = p.evaluate(ctx, cfg, stats)
+	}
+	breached := p.state.breachedMetrics()
+	p.health.record(p.url, stats, err, breached, time.Now())
+	p.summary.recordPoll(p.url, err)
+	if err != nil {
+		p.failures++
+	} else {
+		p.failures = 0
+	}
+	p.events.send(Event{Kind: EventPoll, Server: p.url, Time: time.Now(), Stats: stats, Err: err})
+	if err == nil && p.statsd != nil {
+		p.statsd.send(p.statsdHost, stats)
+	}
+	if err == nil && p.graphite != nil {
+		p.graphite.send(p.statsdHost, stats, p.score, time.Now())
+	}
+	if err == nil && p.influx != nil {
+		p.influx.write(ctx, p.url, stats, time.Now())
+	}
+	if p.store != nil && p.state.dirty {
+		p.store.save(p.url, p.state.saved())
+	}
+
+	if err != nil {
+		pollFailuresCounter.WithLabelValues(p.url).Inc()
+		if reason := parseErrorReason(err); reason != "" {
+			invalidStatsCounter.WithLabelValues(p.url, reason).Inc()
+		}
+		if p.otel != nil {
+			p.otel.recordFailure(ctx, p.url)
+		}
+		slog.ErrorContext(bare(ctx), p.tag(cfg, "Unable to fetch server statistic."), "server", p.url, "error", err)
+		p.recordBreaker(cfg, !isParseError(err))
+		return ExitFailed
+	}
+	p.recordBreaker(cfg, false)
+	if len(breached) > 0 {
+		return ExitUnhealthy
+	}
+	return ExitHealthy
+}
+
+// recordBreaker feeds the poll outcome to the circuit breaker and logs
+// when it pauses or resumes the polling.
+func (p *poller) recordBreaker(cfg *Config, fetchFailed bool) {
+	switch p.breaker.record(fetchFailed, cfg.BreakerFailures, cfg.BreakerCooldown, time.Now()) {
+	case breakerOpened:
+		slog.Warn(p.tag(cfg, "Stats endpoint unavailable, polling paused."), "server", p.url,
+			"failures", cfg.BreakerFailures, "cooldown", cfg.BreakerCooldown.String())
+	case breakerClosed:
+		slog.Info(p.tag(cfg, "Stats endpoint available again, polling resumed."), "server", p.url)
+	}
+}
+
+// tag prefixes msg with the server URL when several servers are polled,
+// the text log leaves out the server attribute.
+func (p *poller) tag(cfg *Config, msg string) string {
+	if len(cfg.servers()) > 1 {
+		return p.url + ": " + msg
+	}
+	return msg
+}
+
+// fetch gets the stats body, connection errors and 5xx and 429 responses
+// are retried with exponential backoff. A 429 or 503 with Retry-After is
+// not retried, the next poll waits for the delay instead.
+func (p *poller) fetch(ctx context.Context, cfg *Config, endpoint string) ([]byte, error) {
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		body, retryable, err := p.fetchOnce(ctx, cfg, endpoint)
+		if err == nil || !retryable || attempt >= cfg.RetryAttempts {
+			return body, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (p *poller) fetchOnce(ctx context.Context, cfg *Config, endpoint string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.HTTPTimeout)
+	defer cancel()
+
+	reqBody, err := cfg.requestBody()
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(reqBody) > 0 && json.Valid(reqBody) {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// asking for gzip explicitly turns off the transport decoding,
+	// so the body is decoded below the same way with or without -header
+	req.Header.Set("Accept-Encoding", "gzip")
+	for name, values := range p.header {
+		req.Header[name] = values
+	}
+	if cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthToken)
+	}
+	if cfg.AuthUser != "" {
+		req.SetBasicAuth(cfg.AuthUser, cfg.AuthPass)
+	}
+
+	// req
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, !errors.Is(err, ErrTooManyRedirects), err
+	}
+	defer resp.Body.Close()
+
+	// check resp satus code
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// without Retry-After the request is retried after the backoff
+		after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return nil, true, fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+		}
+		p.notBefore = time.Now().Add(after)
+		return nil, false, fmt.Errorf("%w: %s, retry after %v", ErrBadStatus, resp.Status, after)
+	default:
+		return nil, resp.StatusCode >= 500, fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+
+	// get resp body
+	body := io.Reader(resp.Body)
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, false, fmt.Errorf("gzip body: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+	bodyBytes, err := io.ReadAll(body)
+	if err != nil {
+		return nil, false, err
+	}
+	return bodyBytes, false, nil
+}
+
+// parseRetryAfter parses a Retry-After value in seconds or as an HTTP
+// date, the delay is capped at maxRetryAfter.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	var after time.Duration
+	if secs, err := strconv.ParseUint(v, 10, 32); err == nil {
+		after = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		after = max(t.Sub(now), 0)
+	} else {
+		return 0, false
+	}
+	return min(after, maxRetryAfter), true
+}
+
+// fetchFailover fetches from the first endpoint that answers, the error
+// of every failed endpoint is returned when none does.
+func (p *poller) fetchFailover(ctx context.Context, cfg *Config) ([]byte, error) {
+	if len(p.endpoints) == 1 {
+		return p.fetch(ctx, cfg, p.endpoints[0])
+	}
+
+	var errs []error
+	for i, endpoint := range p.endpoints {
+		body, err := p.fetch(ctx, cfg, endpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+			continue
+		}
+		if i > 0 {
+			// a Retry-After of a failed endpoint doesn't hold this one back
+			p.notBefore = time.Time{}
+		}
+		if endpoint != p.active {
+			if i == 0 {
+				slog.Info(fmt.Sprintf("Failed back to %s.", endpoint), "server", p.url, "endpoint", endpoint)
+			} else {
+				slog.Warn(fmt.Sprintf("Failed over to %s.", endpoint), "server", p.url, "endpoint", endpoint)
+			}
+			p.active = endpoint
+		}
+		return body, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (p *poller) pollOnce(ctx context.Context, cfg *Config) (*Stats, error) {
+	var bodyBytes []byte
+	var err error
+	if p.source != nil {
+		bodyBytes, err = p.source.read()
+	} else {
+		start := time.Now()
+		bodyBytes, err = p.fetchFailover(ctx, cfg)
+		p.latency = time.Since(start)
+		fetchDurationHistogram.WithLabelValues(p.url).Observe(p.latency.Seconds())
+		slog.Debug("Fetched server statistic.", "server", p.url, "latency", p.latency.String(), "bytes", len(bodyBytes), "error", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parser, ok := parserFor(cfg.Format, parseOptions{strict: cfg.StrictFields, lastLine: cfg.CSVLine == csvLineLast})
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	stats, err := parseStats(bodyBytes, parser)
+	if err != nil {
+		return nil, err
+	}
+
+	loadAverageGauge.WithLabelValues(p.url).Set(stats.LoadAverage)
+	memoryTotalGauge.WithLabelValues(p.url).Set(stats.MemoryTotal)
+	memoryUsedGauge.WithLabelValues(p.url).Set(stats.MemoryUsed)
+	diskTotalGauge.WithLabelValues(p.url).Set(stats.DiskTotal)
+	diskUsedGauge.WithLabelValues(p.url).Set(stats.DiskUsed)
+	networkCapacityGauge.WithLabelValues(p.url).Set(stats.NetworkCapacity)
+	networkUsedGauge.WithLabelValues(p.url).Set(stats.NetworkUsed)
+
+	return stats, nil
+}
+
+// due reports whether the metric with its own interval is evaluated at
+// now, 0 evaluates it on every poll. Half a polling interval of slack
+// keeps a poll a little early from being skipped.
+func (p *poller) due(metric string, interval time.Duration, cfg *Config, now time.Time) bool {
+	if interval <= 0 {
+		return true
+	}
+	if last, ok := p.evaluated[metric]; ok && now.Sub(last) < interval-cfg.PollingInterval/2 {
+		return false
+	}
+	p.evaluated[metric] = now
+	return true
+}
+
+// evaluate checks stats against the thresholds and sends alerts.
+func (p *poller) evaluate(ctx context.Context, cfg *Config, stats *Stats) error {
+	now := time.Now()
+	if p.otel != nil {
+		p.otel.record(ctx, p.url, stats)
+	}
+	over := func(threshold float64, severity string) alertRule {
+		return alertRule{
+			threshold: threshold,
+			severity:  severity,
+			inclusive: cfg.Inclusive,
+			band:      cfg.HysteresisBand,
+			count:     cfg.BreachCount,
+			cooldown:  cfg.AlertCooldown,
+		}
+	}
+	// under is a rule for a free space minimum in bytes, the hysteresis
+	// band is in percentage points so it doesn't apply
+	under := func(threshold float64) alertRule {
+		rule := over(threshold, severityCritical)
+		rule.below, rule.band = true, 0
+		return rule
+	}
+	check := func(metric string, value float64, rule alertRule, breachMsg, recoverMsg string) {
+		rule.rate = cfg.breachRate(metric)
+		alert := Alert{
+			Metric:    metric,
+			Value:     value,
+			Threshold: rule.threshold,
+			Severity:  rule.severity,
+			Server:    p.url,
+			Time:      now,
+		}
+		key := metric
+		if rule.severity == severityWarning {
+			key = warnKey(metric)
+			breachMsg = "Warning: " + breachMsg
+		}
+
+		notifier := p.notifier
+		maintenance := cfg.inMaintenance(now)
+		wasSuppressed := p.state.suppressed(key)
+		escalated := p.state.escalated(key)
+		// escalate passes a breach still active on to the escalation
+		// ladder, unless the critical alert covers it or it is held back
+		escalate := func(msg string) {
+			if key != metric && p.state.breached(metric) || maintenance {
+				return
+			}
+			if rule.severity == severityWarning && cfg.inQuietHours(now) {
+				return
+			}
+			a := alert
+			a.Message = msg
+			p.escalate(ctx, cfg, key, a)
+		}
+		switch p.state.update(key, value, rule, now) {
+		case eventBreach:
+			// the critical alert already covers it
+			if key != metric && p.state.breached(metric) {
+				return
+			}
+			alert.Message = breachMsg
+			p.summary.recordBreach(key)
+			if maintenance {
+				p.state.suppress(key)
+				slog.Info(p.tag(cfg, "Suppressed by maintenance: "+alert.Message), "server", p.url, "metric", metric)
+				return
+			}
+		case eventRecover:
+			// nobody was told about the breach
+			if wasSuppressed {
+				return
+			}
+			// the escalation targets that got the breach get its recovery
+			if escalated > 0 {
+				rungs := cfg.escalations(rule.severity)
+				notifier = join(notifier, p.escalatedTo(rungs[:min(escalated, len(rungs))])...)
+			}
+			if !cfg.NotifyRecovery {
+				notifier = resolversOf(notifier)
+			}
+			alert.Recovered = true
+			alert.Message = recoverMsg
+		default:
+			escalate(breachMsg)
+			return
+		}
+		if rule.severity == severityWarning && cfg.inQuietHours(now) {
+			notifier = localsOf(notifier)
+		}
+		alert.Message = p.tag(cfg, alert.Message)
+		notifier.Notify(ctx, alert)
+		if !alert.Recovered {
+			escalate(breachMsg)
+		}
+	}
+	// checkLevels checks the critical threshold and then the warning one if set
+	checkLevels := func(metric string, value, critical, warn float64, breachMsg, recoverMsg string) {
+		check(metric, value, over(critical, severityCritical), breachMsg, recoverMsg)
+		if warn > 0 {
+			check(metric, value, over(warn, severityWarning), breachMsg, recoverMsg)
+		}
+	}
+
+	// a metric with its own interval keeps its alert state and score part
+	// between the polls it is evaluated at
+	loadDue := p.due(metricLoadAverage, cfg.LoadInterval, cfg, now)
+	memDue := p.due(metricMemoryUsage, cfg.MemoryInterval, cfg, now)
+	diskDue := p.due(metricDiskUsage, cfg.DiskInterval, cfg, now)
+	netDue := p.due(metricNetworkUsage, cfg.NetworkInterval, cfg, now)
+
+	// 1) Load Average
+	if cfg.EnableLoad && loadDue {
+		loadAvg := p.state.smooth(metricLoadAverage, stats.LoadAverage, cfg.SmoothWindow)
+		loadThreshold, loadWarn, perCore := cfg.LoadAverageThreshold, cfg.LoadAverageWarn, ""
+		if cfg.LoadMode == loadModePerCore {
+			cores := stats.CPUCores
+			if cores == 0 {
+				cores = uint64(cfg.CPUCores)
+			}
+			if cores == 0 {
+				return fmt.Errorf("cpuCores=0: %w", ErrZeroTotal)
+			}
+			loadThreshold *= float64(cores)
+			loadWarn *= float64(cores)
+			perCore = fmt.Sprintf(" (%.2f per core)", loadAvg/float64(cores))
+		}
+		p.parts[metricLoadAverage] = scorePart{loadAvg, loadThreshold, cfg.WeightLoad}
+		checkLevels(metricLoadAverage, loadAvg, loadThreshold, loadWarn,
+			fmt.Sprintf("Load Average is too high: %d%s", int(loadAvg), perCore),
+			fmt.Sprintf("Load Average recovered: %d%s", int(loadAvg), perCore))
+	} else if !cfg.EnableLoad {
+		p.state.forget(metricLoadAverage)
+		delete(p.parts, metricLoadAverage)
+	}
+
+	// 2) Memory usage >80%
+	if cfg.EnableMemory && memDue {
+		if stats.MemoryTotal == 0 {
+			return fmt.Errorf("memTotal=0: %w", ErrZeroTotal)
+		}
+		memPct := p.state.smooth(metricMemoryUsage, stats.MemoryUsage(), cfg.SmoothWindow)
+		p.parts[metricMemoryUsage] = scorePart{memPct, cfg.MemoryUsageThreshold, cfg.WeightMemory}
+		memDetail := ""
+		if cfg.Units != unitsMb {
+			memDetail = fmt.Sprintf(" (%s of %s)", formatBytes(stats.MemoryUsed, cfg.Units == unitsSI), formatBytes(stats.MemoryTotal, cfg.Units == unitsSI))
+		}
+		checkLevels(metricMemoryUsage, memPct, cfg.MemoryUsageThreshold, cfg.MemoryUsageWarn,
+			fmt.Sprintf("Memory usage too high: %s%%%s", formatFixed(memPct, cfg.Precision), memDetail),
+			fmt.Sprintf("Memory usage recovered: %s%%%s", formatFixed(memPct, cfg.Precision), memDetail))
+
+		// 2b) Free memory minimum
+		if cfg.MemoryFreeMin > 0 {
+			memFree, si := stats.MemoryFree(), cfg.Units == unitsSI
+			check(metricMemoryFree, memFree, under(float64(cfg.MemoryFreeMin)),
+				fmt.Sprintf("Free memory is too low: %s left, under the %s minimum", formatBytes(memFree, si), formatBytes(float64(cfg.MemoryFreeMin), si)),
+				fmt.Sprintf("Free memory recovered: %s left", formatBytes(memFree, si)))
+		} else {
+			p.state.forget(metricMemoryFree)
+		}
+	} else if !cfg.EnableMemory {
+		p.state.forget(metricMemoryUsage, metricMemoryFree)
+		delete(p.parts, metricMemoryUsage)
+	}
+
+	// 2a) Memory leak
+	if cfg.EnableLeak && memDue {
+		if stats.MemoryTotal == 0 {
+			return fmt.Errorf("memTotal=0: %w", ErrZeroTotal)
+		}
+		rise := p.state.memoryRise(stats.MemoryUsage(), cfg.LeakPolls)
+		rule := alertRule{
+			threshold: cfg.LeakDelta,
+			severity:  severityWarning,
+			inclusive: cfg.Inclusive,
+			count:     1,
+			cooldown:  cfg.AlertCooldown,
+		}
+		check(metricMemoryLeak, rise, rule,
+			fmt.Sprintf("Memory usage keeps growing: +%s%% over %d polls, suspected leak", formatFixed(rise, cfg.Precision), cfg.LeakPolls),
+			"Memory usage stopped growing")
+	} else if !cfg.EnableLeak {
+		p.state.forget(metricMemoryLeak)
+	}
+
+	// 3) Disk usage
+	if cfg.EnableDisk && diskDue {
+		if stats.DiskTotal == 0 {
+			return fmt.Errorf("diskTotal=0: %w", ErrZeroTotal)
+		}
+		diskPct := p.state.smooth(metricDiskUsage, stats.DiskUsage(), cfg.SmoothWindow)
+		p.parts[metricDiskUsage] = scorePart{diskPct, cfg.FreeDiscSpaceThreshold, cfg.WeightDisk}
+		freeBytes := stats.DiskFree()
+		free := fmt.Sprintf("%d Mb", uint64(freeBytes)/(1024*1024))
+		if cfg.Units != unitsMb {
+			free = formatBytes(freeBytes, cfg.Units == unitsSI)
+		}
+		checkLevels(metricDiskUsage, diskPct, cfg.FreeDiscSpaceThreshold, cfg.FreeDiscSpaceWarn,
+			fmt.Sprintf("Free disk space is too low: %s left", free),
+			fmt.Sprintf("Free disk space recovered: %s left", free))
+
+		// 3b) Free disk space minimum
+		if cfg.DiskFreeMin > 0 {
+			si := cfg.Units == unitsSI
+			check(metricDiskFree, freeBytes, under(float64(cfg.DiskFreeMin)),
+				fmt.Sprintf("Free disk space is too low: %s left, under the %s minimum", formatBytes(freeBytes, si), formatBytes(float64(cfg.DiskFreeMin), si)),
+				fmt.Sprintf("Free disk space recovered: %s left", formatBytes(freeBytes, si)))
+		} else {
+			p.state.forget(metricDiskFree)
+		}
+
+		// 3a) Disk fill projection
+		if cfg.DiskETAWarn > 0 {
+			eta := p.state.diskETA(stats.DiskUsed, stats.DiskTotal, now)
+			rule := alertRule{
+				threshold: cfg.DiskETAWarn.Seconds(),
+				severity:  severityCritical,
+				below:     true,
+				inclusive: cfg.Inclusive,
+				count:     cfg.BreachCount,
+				cooldown:  cfg.AlertCooldown,
+			}
+			check(metricDiskETA, eta.Seconds(), rule,
+				fmt.Sprintf("Disk will be full in %v", eta.Round(time.Minute)),
+				"Disk is no longer projected to fill up soon")
+		}
+	} else if !cfg.EnableDisk {
+		p.state.forget(metricDiskUsage, metricDiskETA, metricDiskFree)
+		delete(p.parts, metricDiskUsage)
+	}
+
+	// 4) Network usage
+	if cfg.EnableNetwork && netDue {
+		if stats.NetworkCapacity == 0 {
+			return fmt.Errorf("netCap=0: %w", ErrZeroTotal)
+		}
+		netPct := p.state.smooth(metricNetworkUsage, stats.NetworkUsage(), cfg.SmoothWindow)
+		p.parts[metricNetworkUsage] = scorePart{netPct, cfg.NetworkBandwidthThreshold, cfg.WeightNetwork}
+		freeMbit := stats.NetworkFree() / 1_000_000.0
+		checkLevels(metricNetworkUsage, netPct, cfg.NetworkBandwidthThreshold, cfg.NetworkBandwidthWarn,
+			fmt.Sprintf("Network bandwidth usage high: %s Mbit/s available", formatFixed(freeMbit, cfg.Precision)),
+			fmt.Sprintf("Network bandwidth usage recovered: %s Mbit/s available", formatFixed(freeMbit, cfg.Precision)))
+
+		// 4a) Network usage spike
+		if cfg.NetSpike > 0 {
+			spike := p.state.networkSpike(stats.NetworkUsed)
+			rule := alertRule{
+				threshold: cfg.NetSpike,
+				severity:  severityWarning,
+				inclusive: cfg.Inclusive,
+				count:     1,
+				cooldown:  cfg.AlertCooldown,
+			}
+			check(metricNetworkSpike, spike, rule,
+				fmt.Sprintf("Network usage spiked: +%s%% since the last poll, %s Mbit/s used", formatFixed(spike, cfg.Precision), formatFixed(stats.NetworkUsed/1_000_000.0, cfg.Precision)),
+				"Network usage spike is over")
+		} else {
+			p.state.forget(metricNetworkSpike)
+		}
+	} else if !cfg.EnableNetwork {
+		p.state.forget(metricNetworkUsage, metricNetworkSpike)
+		delete(p.parts, metricNetworkUsage)
+	}
+
+	// 5) Health score
+	parts := make([]scorePart, 0, len(p.parts))
+	for _, metric := range sortedKeys(p.parts) {
+		parts = append(parts, p.parts[metric])
+	}
+	score, ok := healthScore(parts)
+	if ok {
+		healthScoreGauge.WithLabelValues(p.url).Set(score)
+		p.score = &score
+	} else {
+		healthScoreGauge.DeleteLabelValues(p.url)
+		p.score = nil
+	}
+	p.health.recordScore(p.url, p.score)
+	if ok && cfg.HealthFloor > 0 {
+		rule := over(cfg.HealthFloor, severityCritical)
+		rule.below = true
+		check(metricHealthScore, score, rule,
+			fmt.Sprintf("Health score is too low: %s", formatFixed(score, cfg.Precision)),
+			fmt.Sprintf("Health score recovered: %s", formatFixed(score, cfg.Precision)))
+	} else {
+		p.state.forget(metricHealthScore)
+	}
+
+	// 6) Fetch latency
+	if cfg.LatencyWarn > 0 && p.source == nil {
+		rule := alertRule{
+			threshold: cfg.LatencyWarn.Seconds(),
+			severity:  severityWarning,
+			inclusive: cfg.Inclusive,
+			count:     cfg.BreachCount,
+			cooldown:  cfg.AlertCooldown,
+		}
+		check(metricFetchLatency, p.latency.Seconds(), rule,
+			fmt.Sprintf("Stats endpoint is slow: fetched in %v", p.latency.Round(time.Millisecond)),
+			fmt.Sprintf("Stats endpoint is fast again: fetched in %v", p.latency.Round(time.Millisecond)))
+	} else {
+		p.state.forget(metricFetchLatency)
+	}
+
+	slog.Debug("Poll succeeded.", "server", p.url,
+		"load_average", stats.LoadAverage,
+		"memory_total", stats.MemoryTotal, "memory_used", stats.MemoryUsed, "memory_usage", stats.MemoryUsage(),
+		"disk_total", stats.DiskTotal, "disk_used", stats.DiskUsed, "disk_usage", stats.DiskUsage(),
+		"network_capacity", stats.NetworkCapacity, "network_used", stats.NetworkUsed, "network_usage", stats.NetworkUsage())
+
+	return nil
+}
@@ -0,0 +1,398 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recorder is a notifier keeping the alerts it got.
+type recorder struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (r *recorder) Notify(_ context.Context, a Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func (r *recorder) messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, a := range r.alerts {
+		out = append(out, a.Message)
+	}
+	return out
+}
+
+// serveStats starts a stats endpoint answering every request with
+// status and body.
+func serveStats(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testConfig polls url with the default settings and no HTTP endpoints.
+func testConfig(url string) *Config {
+	cfg := DefaultConfig()
+	cfg.StatsURLs = stringList{url}
+	cfg.MetricsAddr = ""
+	cfg.NoSummary = true
+	return &cfg
+}
+
+// pollOnce runs a single poll of cfg and returns its exit code, the
+// messages of the alerts and the poll error.
+func pollOnce(t *testing.T, cfg *Config) (int, []string, error) {
+	t.Helper()
+	rec := &recorder{}
+	m, err := New(cfg, WithNotifier(rec))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	code := m.RunOnce(context.Background())
+
+	var pollErr error
+	for e := range m.Events() {
+		if e.Kind == EventPoll {
+			pollErr = e.Err
+		}
+	}
+	return code, rec.messages(), pollErr
+}
+
+func TestPollOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		code     int
+		messages []string
+		err      error
+	}{
+		{
+			name:   "healthy",
+			status: http.StatusOK,
+			body:   "10,100,50,1000,500,1000,500",
+			code:   ExitHealthy,
+		},
+		{
+			name:     "load average",
+			status:   http.StatusOK,
+			body:     "45,100,50,1000,500,1000,500",
+			code:     ExitUnhealthy,
+			messages: []string{"Load Average is too high: 45"},
+		},
+		{
+			name:     "memory usage",
+			status:   http.StatusOK,
+			body:     "10,100,90,1000,500,1000,500",
+			code:     ExitUnhealthy,
+			messages: []string{"Memory usage too high: 90%"},
+		},
+		{
+			name:     "disk usage",
+			status:   http.StatusOK,
+			body:     "10,100,50,1000000000,950000000,1000,500",
+			code:     ExitUnhealthy,
+			messages: []string{"Free disk space is too low: 47 Mb left"},
+		},
+		{
+			name:     "network usage",
+			status:   http.StatusOK,
+			body:     "10,100,50,1000,500,1000000000,950000000",
+			code:     ExitUnhealthy,
+			messages: []string{"Network bandwidth usage high: 50 Mbit/s available"},
+		},
+		{
+			name:     "every metric",
+			status:   http.StatusOK,
+			body:     "45,100,90,1000000000,950000000,1000000000,950000000",
+			code:     ExitUnhealthy,
+			messages: []string{"Load Average is too high: 45", "Memory usage too high: 90%", "Free disk space is too low: 47 Mb left", "Network bandwidth usage high: 50 Mbit/s available"},
+		},
+		{
+			name:   "decimals under the thresholds",
+			status: http.StatusOK,
+			body:   "29.9,100.5,80.3,1000.5,500.25,1000,500.5",
+			code:   ExitHealthy,
+		},
+		{
+			name:     "decimal load average",
+			status:   http.StatusOK,
+			body:     "30.5,100,50,1000,500,1000,500",
+			code:     ExitUnhealthy,
+			messages: []string{"Load Average is too high: 30"},
+		},
+		{
+			name:     "decimal memory usage",
+			status:   http.StatusOK,
+			body:     "10,100,80.5,1000,500,1000,500",
+			code:     ExitUnhealthy,
+			messages: []string{"Memory usage too high: 80%"},
+		},
+		{
+			name:   "malformed body",
+			status: http.StatusOK,
+			body:   "a,b,c,d,e,f,g",
+			code:   ExitFailed,
+			err:    ErrTooManyParseErrors,
+		},
+		{
+			name:   "wrong field count",
+			status: http.StatusOK,
+			body:   "10,100,50",
+			code:   ExitFailed,
+			err:    ErrFieldCount,
+		},
+		{
+			name:   "memory used over total",
+			status: http.StatusOK,
+			body:   "10,100,101,1000,500,1000,500",
+			code:   ExitFailed,
+			err:    ErrUsedOverTotal,
+		},
+		{
+			name:   "zero memory total",
+			status: http.StatusOK,
+			body:   "10,0,0,1000,500,1000,500",
+			code:   ExitFailed,
+			err:    ErrZeroTotal,
+		},
+		{
+			name:   "bad status",
+			status: http.StatusInternalServerError,
+			body:   "10,100,50,1000,500,1000,500",
+			code:   ExitFailed,
+			err:    ErrBadStatus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveStats(t, tt.status, tt.body)
+			code, messages, err := pollOnce(t, testConfig(srv.URL))
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			if !slices.Equal(messages, tt.messages) {
+				t.Errorf("messages = %q, want %q", messages, tt.messages)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPollOnceInclusive(t *testing.T) {
+	const body = "30,100,80,1000,900,1000,900"
+	tests := []struct {
+		name      string
+		inclusive bool
+		code      int
+		messages  []string
+	}{
+		{"strict", false, ExitHealthy, nil},
+		{"inclusive", true, ExitUnhealthy, []string{
+			"Load Average is too high: 30",
+			"Memory usage too high: 80%",
+			"Free disk space is too low: 0 Mb left",
+			"Network bandwidth usage high: 0 Mbit/s available",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(serveStats(t, http.StatusOK, body).URL)
+			cfg.Inclusive = tt.inclusive
+			code, messages, err := pollOnce(t, cfg)
+			if err != nil {
+				t.Fatalf("poll error: %v", err)
+			}
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			if !slices.Equal(messages, tt.messages) {
+				t.Errorf("messages = %q, want %q", messages, tt.messages)
+			}
+		})
+	}
+}
+
+func TestFetchGzip(t *testing.T) {
+	const body = "45,100,50,1000,500,1000,500"
+	var zipped bytes.Buffer
+	gz := gzip.NewWriter(&zipped)
+	io.WriteString(gz, body)
+	gz.Close()
+
+	for _, encoding := range []string{"gzip", "identity"} {
+		t.Run(encoding, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != "gzip" {
+					t.Errorf("Accept-Encoding = %q, want gzip", got)
+				}
+				w.Header().Set("Content-Encoding", encoding)
+				if encoding == "gzip" {
+					w.Write(zipped.Bytes())
+				} else {
+					io.WriteString(w, body)
+				}
+			}))
+			defer srv.Close()
+
+			code, messages, err := pollOnce(t, testConfig(srv.URL))
+			if err != nil {
+				t.Fatalf("poll error: %v", err)
+			}
+			want := []string{"Load Average is too high: 45"}
+			if code != ExitUnhealthy || !slices.Equal(messages, want) {
+				t.Errorf("poll = %d, %q, want %d, %q", code, messages, ExitUnhealthy, want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"86400", maxRetryAfter, true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:59:00 GMT", 0, true},
+		{"Tue, 02 Jan 2024 00:00:00 GMT", maxRetryAfter, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.in, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %t, want %v, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFetchRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter func() string
+		requests   int
+		delay      time.Duration
+	}{
+		{"429 in seconds", http.StatusTooManyRequests, func() string { return "120" }, 1, 2 * time.Minute},
+		{"503 as a date", http.StatusServiceUnavailable, func() string {
+			return time.Now().Add(10 * time.Minute).UTC().Format(http.TimeFormat)
+		}, 1, 10 * time.Minute},
+		// without the header the request is retried after the backoff
+		{"429 without the header", http.StatusTooManyRequests, nil, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				requests.Add(1)
+				if tt.retryAfter != nil {
+					w.Header().Set("Retry-After", tt.retryAfter())
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			cfg := testConfig(srv.URL)
+			cfg.RetryAttempts = 3
+			cfg.RetryBackoff = time.Millisecond
+			m, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			start := time.Now()
+			if code := m.RunOnce(context.Background()); code != ExitFailed {
+				t.Errorf("exit code = %d, want %d", code, ExitFailed)
+			}
+			if got := int(requests.Load()); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+
+			notBefore := m.pollers[0].notBefore
+			if tt.delay == 0 {
+				if !notBefore.IsZero() {
+					t.Errorf("next poll delayed until %v, want no delay", notBefore)
+				}
+				return
+			}
+			// the date form loses the sub-second part of the delay
+			if got := notBefore.Sub(start); got < tt.delay-time.Second || got > tt.delay+time.Second {
+				t.Errorf("next poll delayed by %v, want %v", got, tt.delay)
+			}
+		})
+	}
+}
+
+func TestPollOnceFreeMin(t *testing.T) {
+	// 1 GiB of memory and 5 GiB of disk free, only the minimums alert
+	const body = "10,2147483648,1073741824,107374182400,102005473280,1000,500"
+	cfg := testConfig(serveStats(t, http.StatusOK, body).URL)
+	cfg.FreeDiscSpaceThreshold = 100
+	cfg.DiskFreeMin = 10 << 30
+	cfg.MemoryFreeMin = 2 << 30
+	code, messages, err := pollOnce(t, cfg)
+	if err != nil {
+		t.Fatalf("poll error: %v", err)
+	}
+	want := []string{
+		"Free memory is too low: 1.0 GiB left, under the 2.0 GiB minimum",
+		"Free disk space is too low: 5.0 GiB left, under the 10.0 GiB minimum",
+	}
+	if code != ExitUnhealthy || !slices.Equal(messages, want) {
+		t.Errorf("poll = %d, %q, want %d, %q", code, messages, ExitUnhealthy, want)
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Adaptive = true
+	cfg.AdaptiveMin, cfg.AdaptiveMax, cfg.AdaptiveStep = 10*time.Second, 30*time.Second, 5*time.Second
+	tests := []struct {
+		name     string
+		interval time.Duration
+		healthy  bool
+		want     time.Duration
+	}{
+		{"healthy", 10 * time.Second, true, 15 * time.Second},
+		{"unhealthy", 20 * time.Second, false, 15 * time.Second},
+		{"at the ceiling", 30 * time.Second, true, 30 * time.Second},
+		{"at the floor", 10 * time.Second, false, 10 * time.Second},
+		// intervals a reload left outside the bounds
+		{"healthy under the floor", 2 * time.Second, true, 10 * time.Second},
+		{"unhealthy over the ceiling", time.Hour, false, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := adapt(&cfg, tt.interval, tt.healthy); got != tt.want {
+			t.Errorf("%s: adapt(%v) = %v, want %v", tt.name, tt.interval, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	metricLoadAverage  = "load_average"
+	metricMemoryUsage  = "memory_usage"
+	metricMemoryLeak   = "memory_leak"
+	metricMemoryFree   = "memory_free"
+	metricDiskFree     = "disk_free"
+	metricDiskUsage    = "disk_usage"
+	metricDiskETA      = "disk_eta"
+	metricNetworkUsage = "network_usage"
+	metricNetworkSpike = "network_spike"
+	metricFetchLatency = "fetch_latency"
+)
+
+// alert severities
+const (
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+const (
+	webhookRetryDelay = time.Second
+
+	// discord rejects longer message content
+	discordMessageLimit = 2000
+
+	telegramAPI          = "https://api.telegram.org"
+	telegramMessageLimit = 4096
+
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+	// the most of a notification response body that is read
+	maxResponseBody = 4096
+
+	syslogTag = "stat_loader"
+
+	defaultWebhookTemplate = `{"metric":{{json .Metric}},"value":{{.Value}},"threshold":{{.Threshold}},` +
+		`"severity":{{json .Severity}},"server":{{json .Server}},"message":{{json .Message}},"timestamp":{{json .Time}}}`
+)
+
+// Alert is a threshold breach or recovery of a server metric.
+type Alert struct {
+	Metric    string
+	Value     float64
+	Threshold float64
+	Severity  string
+	Server    string
+	Message   string
+	Recovered bool
+	Time      time.Time
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// logNotifier is the default notifier, it writes alerts to the log.
+type logNotifier struct{}
+
+func (logNotifier) local() {}
+
+func (logNotifier) Notify(ctx context.Context, a Alert) error {
+	level := slog.LevelError
+	switch {
+	case a.Recovered:
+		level = slog.LevelInfo
+	case a.Severity == severityWarning:
+		level = slog.LevelWarn
+	}
+	slog.Log(bare(ctx), level, a.Message, "metric", a.Metric, "value", a.Value, "threshold", a.Threshold, "severity", a.Severity, "recovered", a.Recovered)
+	return nil
+}
+
+// notifiers fans an alert out to every notifier, failures are logged
+// so that one broken integration doesn't affect the others.
+type notifiers []Notifier
+
+func (ns notifiers) Notify(ctx context.Context, a Alert) error {
+	for _, n := range ns {
+		if err := n.Notify(ctx, a); err != nil {
+			slog.ErrorContext(ctx, "Unable to send notification.", "notifier", fmt.Sprintf("%T", unwrapNotifier(n)), "error", err)
+		}
+	}
+	return nil
+}
+
+// unwrapNotifier returns the notifier that n delivers the alerts with.
+func unwrapNotifier(n Notifier) Notifier {
+	for {
+		switch w := n.(type) {
+		case *dispatchedNotifier:
+			n = w.next
+		case *coalescingNotifier:
+			n = w.next
+		case *retryNotifier:
+			n = w.next
+		case *dryRunNotifier:
+			n = w.next
+		default:
+			return n
+		}
+	}
+}
+
+// close sends the buffered alerts and releases the connections held
+// by the notifiers.
+func (ns notifiers) close() {
+	for _, n := range ns {
+		if err := closeNotifier(n); err != nil {
+			slog.Error("Unable to close notifier.", "notifier", fmt.Sprintf("%T", n), "error", err)
+		}
+	}
+}
+
+func closeNotifier(n Notifier) error {
+	if d, ok := n.(*dryRunNotifier); ok {
+		n = d.next
+	}
+	if c, ok := n.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// resolver is implemented by notifiers that close what a breach opened,
+// they get recoveries even when recovery notifications are off.
+type resolver interface {
+	resolves()
+}
+
+// resolversOf narrows n to the notifiers that are resolvers.
+func resolversOf(n Notifier) Notifier {
+	return narrow(n, isResolver)
+}
+
+// localNotifier is implemented by the notifiers that stay in the
+// process: the log, the event stream and the callbacks.
+type localNotifier interface {
+	local()
+}
+
+// localsOf narrows n to the local notifiers.
+func localsOf(n Notifier) Notifier {
+	return narrow(n, func(n Notifier) bool {
+		_, ok := n.(localNotifier)
+		return ok
+	})
+}
+
+// join lists n and more flat, so that narrow sees each notifier.
+func join(n Notifier, more ...Notifier) notifiers {
+	var out notifiers
+	if ns, ok := n.(notifiers); ok {
+		out = append(out, ns...)
+	} else {
+		out = append(out, n)
+	}
+	return append(out, more...)
+}
+
+func narrow(n Notifier, keep func(Notifier) bool) Notifier {
+	var kept notifiers
+	if ns, ok := n.(notifiers); ok {
+		for _, n := range ns {
+			if keep(n) {
+				kept = append(kept, n)
+			}
+		}
+	} else if keep(n) {
+		kept = append(kept, n)
+	}
+	return kept
+}
+
+func isResolver(n Notifier) bool {
+	_, ok := unwrapNotifier(n).(resolver)
+	return ok
+}
+
+// callbackNotifier hands alerts to the embedding code. It resolves,
+// so onRecover is called even when recovery notifications are off.
+type callbackNotifier struct {
+	onAlert   func(Alert)
+	onRecover func(Alert)
+}
+
+func (n callbackNotifier) resolves() {}
+
+func (n callbackNotifier) local() {}
+
+func (n callbackNotifier) Notify(_ context.Context, a Alert) error {
+	fn := n.onAlert
+	if a.Recovered {
+		fn = n.onRecover
+	}
+	if fn != nil {
+		fn(a)
+	}
+	return nil
+}
+
+// dryRunNotifier prints the alerts next would have sent.
+type dryRunNotifier struct {
+	name string
+	next Notifier
+	w    io.Writer
+}
+
+func (n *dryRunNotifier) Notify(_ context.Context, a Alert) error {
+	_, err := fmt.Fprintf(n.w, "[DRY-RUN] %s: %s\n", n.name, a.Message)
+	return err
+}
+
+type slackNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(map[string]string{"text": a.Message})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.webhookURL, body)
+}
+
+type discordNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+func (n *discordNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(map[string]string{"content": truncate(a.Message, discordMessageLimit)})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.webhookURL, body)
+}
+
+// truncate cuts s to at most limit runes, marking the cut with an ellipsis.
+func truncate(s string, limit int) string {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s
+	}
+	return string(r[:limit-1]) + "…"
+}
+
+type telegramNotifier struct {
+	client *http.Client
+	api    string
+	token  string
+	chatID string
+}
+
+func (n *telegramNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(map[string]string{"chat_id": n.chatID, "text": truncate(a.Message, telegramMessageLimit)})
+	if err != nil {
+		return err
+	}
+	err = postJSON(ctx, n.client, n.api+"/bot"+n.token+"/sendMessage", body)
+
+	// keep the token out of the logs
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL = n.api + "/bot<redacted>/sendMessage"
+	}
+	return err
+}
+
+// teamsNotifier posts an Adaptive Card to a Teams incoming webhook.
+type teamsNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Type    string          `json:"type"`
+	Schema  string          `json:"$schema"`
+	Version string          `json:"version"`
+	Body    []teamsCardItem `json:"body"`
+}
+
+type teamsCardItem struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func (n *teamsNotifier) Notify(ctx context.Context, a Alert) error {
+	color := "Attention"
+	switch {
+	case a.Recovered:
+		color = "Good"
+	case a.Severity == severityWarning:
+		color = "Warning"
+	}
+	card := teamsCard{
+		Type:    "AdaptiveCard",
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Version: "1.4",
+		Body: []teamsCardItem{
+			{Type: "TextBlock", Text: a.Message, Weight: "Bolder", Color: color, Wrap: true},
+			{Type: "FactSet", Facts: []teamsFact{
+				{"Metric", a.Metric},
+				{"Value", strconv.FormatFloat(a.Value, 'g', -1, 64)},
+				{"Threshold", strconv.FormatFloat(a.Threshold, 'g', -1, 64)},
+				{"Severity", a.Severity},
+				{"Server", a.Server},
+				{"Time", a.Time.Format(time.RFC3339)},
+			}},
+		},
+	}
+	body, err := json.Marshal(teamsMessage{
+		Type:        "message",
+		Attachments: []teamsAttachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: card}},
+	})
+	if err != nil {
+		return err
+	}
+	return postWith(ctx, n.client, n.webhookURL, http.Header{"Content-Type": {"application/json"}}, body, checkTeamsResponse)
+}
+
+// checkTeamsResponse accepts the empty body of workflow webhooks and the
+// "1" of connector ones, connectors report some errors, like throttling,
+// as a 2xx response with the error text in the body.
+func checkTeamsResponse(body []byte) error {
+	text := strings.TrimSpace(string(body))
+	if text == "" || text == "1" {
+		return nil
+	}
+	return fmt.Errorf("teams: %s", text)
+}
+
+type pagerDutyNotifier struct {
+	client     *http.Client
+	url        string
+	routingKey string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Timestamp     time.Time      `json:"timestamp"`
+	Component     string         `json:"component"`
+	CustomDetails map[string]any `json:"custom_details"`
+}
+
+func (n *pagerDutyNotifier) resolves() {}
+
+// Notify triggers an incident per metric, severity and server, repeated
+// breaches update it and a recovery resolves it.
+func (n *pagerDutyNotifier) Notify(ctx context.Context, a Alert) error {
+	event := pagerDutyEvent{
+		RoutingKey:  n.routingKey,
+		EventAction: "resolve",
+		DedupKey:    a.Metric + "/" + a.Severity + "@" + a.Server,
+	}
+	if !a.Recovered {
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			Summary:   a.Message,
+			Source:    a.Server,
+			Severity:  a.Severity,
+			Timestamp: a.Time,
+			Component: a.Metric,
+			CustomDetails: map[string]any{
+				"value":     a.Value,
+				"threshold": a.Threshold,
+			},
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, body)
+}
+
+type webhookNotifier struct {
+	client  *http.Client
+	url     string
+	payload *template.Template
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, a Alert) error {
+	var body bytes.Buffer
+	if err := n.payload.Execute(&body, a); err != nil {
+		return fmt.Errorf("render webhook payload: %w", err)
+	}
+	return postJSON(ctx, n.client, n.url, body.Bytes())
+}
+
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// postJSON sends a JSON body to url, a 5xx response is retried once.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	return post(ctx, client, url, http.Header{"Content-Type": {"application/json"}}, body)
+}
+
+// post sends body with header to url, a 5xx response is retried once.
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	return postWith(ctx, client, url, header, body, nil)
+}
+
+// postWith is post with check also applied to the body of a 2xx
+// response, for services that report errors in it.
+func postWith(ctx context.Context, client *http.Client, url string, header http.Header, body []byte, check func([]byte) error) error {
+	status, err := doPost(ctx, client, url, header, body, check)
+	if err == nil || status < 500 {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(webhookRetryDelay):
+	}
+
+	_, err = doPost(ctx, client, url, header, body, check)
+	return err
+}
+
+func doPost(ctx context.Context, client *http.Client, url string, header http.Header, body []byte, check func([]byte) error) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w: %s", ErrBadStatus, resp.Status)
+	}
+	if check != nil {
+		return resp.StatusCode, check(respBody)
+	}
+	return resp.StatusCode, nil
+}
+
+// newNotifier builds the configured notifiers, the escalation targets are
+// returned apart by name.
+func newNotifier(cfg *Config) (notifiers, map[string]Notifier, error) {
+	// validate leaves the dead-letter file alone, it is created here so
+	// that the retries can always append to it
+	if cfg.DeadLetterFile != "" && !cfg.DryRun {
+		if err := createFile(cfg.DeadLetterFile); err != nil {
+			return nil, nil, fmt.Errorf("deadletter-file: %w", err)
+		}
+	}
+	ns := notifiers{logNotifier{}}
+	names := []string{"log"}
+
+	// add appends an external notifier, in dry-run it only prints alerts.
+	// Resolvers are never coalesced, they track every metric on its own.
+	add := func(name string, n Notifier) {
+		_, resolves := n.(resolver)
+		if cfg.DryRun {
+			n = &dryRunNotifier{name: name, next: n, w: os.Stdout}
+		} else if cfg.NotifyRetries > 0 || cfg.DeadLetterFile != "" {
+			n = newRetryNotifier(name, n, cfg)
+		}
+		if cfg.CoalesceWindow > 0 && !resolves {
+			n = newCoalescingNotifier(n, cfg.CoalesceWindow)
+		}
+		ns = append(ns, n)
+		names = append(names, name)
+	}
+
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+	if cfg.SlackWebhook != "" {
+		add("slack", &slackNotifier{client: client, webhookURL: cfg.SlackWebhook})
+	}
+	if cfg.DiscordWebhook != "" {
+		add("discord", &discordNotifier{client: client, webhookURL: cfg.DiscordWebhook})
+	}
+	if cfg.TelegramToken != "" {
+		add("telegram", &telegramNotifier{client: client, api: telegramAPI, token: cfg.TelegramToken, chatID: cfg.TelegramChatID})
+	}
+	if cfg.TeamsWebhook != "" {
+		add("teams", &teamsNotifier{client: client, webhookURL: cfg.TeamsWebhook})
+	}
+	if cfg.PagerDutyKey != "" {
+		add("pagerduty", &pagerDutyNotifier{client: client, url: pagerDutyEventsURL, routingKey: cfg.PagerDutyKey})
+	}
+	if cfg.WebhookURL != "" {
+		payload, err := parseWebhookTemplate(cfg.WebhookTemplate)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid webhook-template: %w", err)
+		}
+		add("webhook", &webhookNotifier{client: client, url: cfg.WebhookURL, payload: payload})
+	}
+	if cfg.SyslogAddr != "" {
+		n, err := newSyslogNotifier(cfg.SyslogNetwork, cfg.SyslogAddr)
+		if err != nil {
+			ns.close()
+			return nil, nil, err
+		}
+		add("syslog", n)
+	}
+
+	// the log stays in line with the polls, the other notifiers are
+	// dispatched in the background
+	if cfg.NotifyWorkers > 0 && len(ns) > 1 {
+		newDispatchPool(cfg.NotifyWorkers, cfg.NotifyBuffer, cfg.NotifyBlock).wrap(ns[1:])
+	}
+
+	// the escalation targets only get escalations
+	targets := cfg.escalationTargets()
+	escalation := make(map[string]Notifier)
+	kept := ns[:0]
+	for i, n := range ns {
+		if targets[names[i]] {
+			escalation[names[i]] = n
+			continue
+		}
+		kept = append(kept, n)
+	}
+	return kept, escalation, nil
+}
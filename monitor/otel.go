@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// otelShutdownTimeout bounds the final export on shutdown.
+const otelShutdownTimeout = 5 * time.Second
+
+// otelMetrics records the stats through an OpenTelemetry meter exported
+// over OTLP/gRPC.
+type otelMetrics struct {
+	provider *sdkmetric.MeterProvider
+
+	loadAverage  metric.Float64Gauge
+	memoryUsage  metric.Float64Gauge
+	diskUsage    metric.Float64Gauge
+	networkUsage metric.Float64Gauge
+	pollFailures metric.Int64Counter
+}
+
+func newOtelMetrics(ctx context.Context, cfg *Config) (*otelMetrics, error) {
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(cfg.OTLPEndpoint)}
+	if cfg.OTLPInsecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+
+	m := &otelMetrics{
+		provider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter))),
+	}
+	meter := m.provider.Meter(metricsNamespace)
+
+	gauges := []struct {
+		gauge       *metric.Float64Gauge
+		name, unit  string
+		description string
+	}{
+		{&m.loadAverage, metricLoadAverage, "1", "Load average of the server."},
+		{&m.memoryUsage, metricMemoryUsage, "%", "Memory usage of the server."},
+		{&m.diskUsage, metricDiskUsage, "%", "Disk usage of the server."},
+		{&m.networkUsage, metricNetworkUsage, "%", "Network bandwidth usage of the server."},
+	}
+	for _, g := range gauges {
+		*g.gauge, err = meter.Float64Gauge(metricsNamespace+"."+g.name, metric.WithUnit(g.unit), metric.WithDescription(g.description))
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.pollFailures, err = meter.Int64Counter(metricsNamespace+".poll_failures", metric.WithDescription("Failed polls of the server."))
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *otelMetrics) record(ctx context.Context, server string, stats *Stats) {
+	attrs := metric.WithAttributes(attribute.String("server", server))
+	m.loadAverage.Record(ctx, stats.LoadAverage, attrs)
+	m.memoryUsage.Record(ctx, stats.MemoryUsage(), attrs)
+	m.diskUsage.Record(ctx, stats.DiskUsage(), attrs)
+	m.networkUsage.Record(ctx, stats.NetworkUsage(), attrs)
+}
+
+func (m *otelMetrics) recordFailure(ctx context.Context, server string) {
+	m.pollFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("server", server)))
+}
+
+// shutdown exports the last observations, waiting up to otelShutdownTimeout.
+func (m *otelMetrics) shutdown() error {
+	if m == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), otelShutdownTimeout)
+	defer cancel()
+	return m.provider.Shutdown(ctx)
+}
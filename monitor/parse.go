@@ -0,0 +1,301 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// stats body formats
+const (
+	formatAuto = "auto"
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// -csv-line values
+const (
+	csvLineFirst = "first"
+	csvLineLast  = "last"
+)
+
+// parseOptions tune the parsing of stats bodies.
+type parseOptions struct {
+	// strict rejects CSV stats with extra fields
+	strict bool
+	// lastLine picks the last CSV data line instead of the first one
+	lastLine bool
+}
+
+// Parser turns a stats response body into Stats.
+type Parser interface {
+	Parse(body []byte) (*Stats, error)
+}
+
+// built-in parsers
+type (
+	autoParser struct{ opts parseOptions }
+	csvParser  struct{ opts parseOptions }
+	jsonParser struct{}
+)
+
+func (p autoParser) Parse(body []byte) (*Stats, error) { return detectAndParse(body, p.opts) }
+
+func (p csvParser) Parse(body []byte) (*Stats, error) { return parseCSV(body, p.opts) }
+
+func (jsonParser) Parse(body []byte) (*Stats, error) { return parseJSON(body, parseOptions{}) }
+
+var (
+	customParsersMu sync.RWMutex
+	customParsers   = make(map[string]Parser)
+)
+
+// RegisterParser makes p available as the Format name. It panics if
+// name is empty, built in or already registered.
+func RegisterParser(name string, p Parser) {
+	customParsersMu.Lock()
+	defer customParsersMu.Unlock()
+
+	if _, ok := customParsers[name]; ok || name == "" || name == formatAuto || name == formatCSV || name == formatJSON {
+		panic(fmt.Sprintf("monitor: cannot register parser %q", name))
+	}
+	customParsers[name] = p
+}
+
+// parserFor returns the parser of format, the options only apply
+// to the built-in parsers.
+func parserFor(format string, opts parseOptions) (Parser, bool) {
+	switch format {
+	case formatAuto:
+		return autoParser{opts}, true
+	case formatCSV:
+		return csvParser{opts}, true
+	case formatJSON:
+		return jsonParser{}, true
+	}
+	customParsersMu.RLock()
+	defer customParsersMu.RUnlock()
+	p, ok := customParsers[format]
+	return p, ok
+}
+
+// maxLoadAverage is far over the load of any real machine, a higher
+// one comes from a corrupt feed.
+const maxLoadAverage = 1_000_000
+
+// parseStats parses body with p and rejects values that cannot be real.
+func parseStats(body []byte, p Parser) (*Stats, error) {
+	stats, err := p.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("%w: no stats parsed", ErrMalformedBody)
+	}
+	if err := validateStats(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// validateStats checks the used values against their totals. Zero totals
+// are left to the evaluation, which skips disabled metrics.
+func validateStats(s *Stats) error {
+	if s.LoadAverage > maxLoadAverage {
+		return fmt.Errorf("%w: %g", ErrLoadOutOfRange, s.LoadAverage)
+	}
+	if s.MemoryTotal > 0 && s.MemoryUsed > s.MemoryTotal {
+		return fmt.Errorf("memUsed>memTotal: %w", ErrUsedOverTotal)
+	}
+	if s.DiskTotal > 0 && s.DiskUsed > s.DiskTotal {
+		return fmt.Errorf("diskUsed>diskTotal: %w", ErrUsedOverTotal)
+	}
+	if s.NetworkCapacity > 0 && s.NetworkUsed > s.NetworkCapacity {
+		return fmt.Errorf("netUsed>netCap: %w", ErrUsedOverTotal)
+	}
+	return nil
+}
+
+// detectAndParse sniffs the body format, a body starting with '{' or '['
+// is JSON and anything else is CSV. Errors name the detected format.
+func detectAndParse(body []byte, opts parseOptions) (*Stats, error) {
+	format := detectFormat(body)
+	if format == "" {
+		return nil, ErrEmptyBody
+	}
+	parse := parseCSV
+	if format == formatJSON {
+		parse = parseJSON
+	}
+	stats, err := parse(body, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", format, err)
+	}
+	return stats, nil
+}
+
+func detectFormat(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	switch body[0] {
+	case '{', '[':
+		return formatJSON
+	default:
+		return formatCSV
+	}
+}
+
+// parseCSV parses a CSV stats body, up to 3 malformed fields are
+// tolerated and left zero. Unless strict, extra trailing fields are ignored.
+func parseCSV(body []byte, opts parseOptions) (*Stats, error) {
+	// get parts and check for len
+	line := dataLine(string(body), opts.lastLine)
+	if line == "" {
+		return nil, ErrEmptyBody
+	}
+	parts := splitCSV(line)
+	if len(parts) < statsFieldCount || opts.strict && len(parts) > statsFieldCount {
+		return nil, fmt.Errorf("%w: %d", ErrFieldCount, len(parts))
+	}
+
+	errNum := 0
+	stats := &Stats{}
+
+	// get data
+	for i, field := range stats.fields() {
+		v, ok := parseValue(parts[i])
+		if !ok {
+			errNum++
+		}
+		*field = v
+	}
+
+	if errNum > 3 {
+		return nil, ErrTooManyParseErrors
+	}
+
+	return stats, nil
+}
+
+// dataLine picks the first or last data line of a CSV body. Blank lines
+// and # comments are skipped, and so are header lines without a single
+// number unless no line has one.
+func dataLine(body string, last bool) string {
+	var lines, data []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+		if hasNumber(line) {
+			data = append(data, line)
+		}
+	}
+	if len(data) == 0 {
+		data = lines
+	}
+	if len(data) == 0 {
+		return ""
+	}
+	if last {
+		return data[len(data)-1]
+	}
+	return data[0]
+}
+
+func hasNumber(line string) bool {
+	for _, field := range splitCSV(line) {
+		if _, ok := parseValue(field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseValue parses a stats value, integral or decimal. Negative, NaN and
+// infinite values are rejected and left zero.
+func parseValue(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// splitCSV splits a line into trimmed fields. Blank fields are kept
+// in place, so they fail number parsing and count as malformed values
+// instead of shifting the following fields.
+func splitCSV(s string) []string {
+	parts := strings.Split(s, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return parts
+}
+
+// jsonStats is the JSON stats body, every field but cores is required.
+type jsonStats struct {
+	Load      *float64 `json:"load"`
+	MemTotal  *float64 `json:"mem_total"`
+	MemUsed   *float64 `json:"mem_used"`
+	DiskTotal *float64 `json:"disk_total"`
+	DiskUsed  *float64 `json:"disk_used"`
+	NetCap    *float64 `json:"net_cap"`
+	NetUsed   *float64 `json:"net_used"`
+
+	// optional
+	Cores uint64 `json:"cores"`
+}
+
+// parseJSON parses a JSON stats body. Unknown fields are ignored, the
+// options only apply to CSV.
+func parseJSON(body []byte, _ parseOptions) (*Stats, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, ErrEmptyBody
+	}
+
+	var js jsonStats
+	if err := json.Unmarshal(body, &js); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedBody, err)
+	}
+
+	stats := &Stats{CPUCores: js.Cores}
+	fields := []struct {
+		name string
+		src  *float64
+		dst  *float64
+	}{
+		{"load", js.Load, &stats.LoadAverage},
+		{"mem_total", js.MemTotal, &stats.MemoryTotal},
+		{"mem_used", js.MemUsed, &stats.MemoryUsed},
+		{"disk_total", js.DiskTotal, &stats.DiskTotal},
+		{"disk_used", js.DiskUsed, &stats.DiskUsed},
+		{"net_cap", js.NetCap, &stats.NetworkCapacity},
+		{"net_used", js.NetUsed, &stats.NetworkUsed},
+	}
+
+	var missing []string
+	for _, f := range fields {
+		if f.src == nil {
+			missing = append(missing, f.name)
+			continue
+		}
+		if *f.src < 0 {
+			return nil, fmt.Errorf("%w: negative %s", ErrMalformedBody, f.name)
+		}
+		*f.dst = *f.src
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingFields, strings.Join(missing, ", "))
+	}
+
+	return stats, nil
+}
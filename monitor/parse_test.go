@@ -0,0 +1,282 @@
+package monitor
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitCSV(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"1,2,3", []string{"1", "2", "3"}},
+		{" 1 ,\t2,  3  ", []string{"1", "2", "3"}},
+		{"1,2,3,", []string{"1", "2", "3", ""}},
+		{"1,,3", []string{"1", "", "3"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := splitCSV(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitCSV(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSVFields(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *Stats
+		err  error
+	}{
+		{
+			name: "extra whitespace",
+			body: "  10 , 100 ,50,1000, 500 ,1000,500 \n",
+			want: &Stats{10, 100, 50, 1000, 500, 1000, 500, 0},
+		},
+		{
+			name: "blank field",
+			body: "10,,50,1000,500,1000,500",
+			want: &Stats{10, 0, 50, 1000, 500, 1000, 500, 0},
+		},
+		{
+			name: "trailing comma",
+			body: "10,100,50,1000,500,1000,500,",
+			err:  ErrFieldCount,
+		},
+		{
+			name: "too many blank fields",
+			body: "10,,,,,1000,500",
+			err:  ErrTooManyParseErrors,
+		},
+		{
+			name: "empty body",
+			body: "",
+			err:  ErrEmptyBody,
+		},
+		{
+			name: "blank body",
+			body: " \n\t\n",
+			err:  ErrEmptyBody,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV([]byte(tt.body), parseOptions{strict: true})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("stats = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVDecimals(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *Stats
+		err  error
+	}{
+		{
+			name: "decimal fields",
+			body: "12.5,100.25,50.5,1000,500.75,1000,0.5",
+			want: &Stats{12.5, 100.25, 50.5, 1000, 500.75, 1000, 0.5, 0},
+		},
+		{
+			name: "integral fields",
+			body: "12,100,50,1000,500,1000,500",
+			want: &Stats{12, 100, 50, 1000, 500, 1000, 500, 0},
+		},
+		{
+			name: "exponent",
+			body: "1.5e1,1e2,5e1,1e3,5e2,1e3,5e2",
+			want: &Stats{15, 100, 50, 1000, 500, 1000, 500, 0},
+		},
+		{
+			name: "leading dot",
+			body: ".5,100,50,1000,500,1000,500",
+			want: &Stats{0.5, 100, 50, 1000, 500, 1000, 500, 0},
+		},
+		{
+			name: "negative, not a number and infinite",
+			body: "-12.5,NaN,50,1000,500,Inf,500",
+			want: &Stats{0, 0, 50, 1000, 500, 0, 500, 0},
+		},
+		{
+			name: "decimal comma",
+			body: "12,5,100,50,1000,500,1000,500",
+			err:  ErrFieldCount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV([]byte(tt.body), parseOptions{strict: true})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("stats = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVStrictFields(t *testing.T) {
+	want := Stats{10, 100, 50, 1000, 500, 1000, 500, 0}
+	tests := []struct {
+		name   string
+		body   string
+		strict bool
+		err    error
+	}{
+		{"7 fields strict", "10,100,50,1000,500,1000,500", true, nil},
+		{"7 fields lenient", "10,100,50,1000,500,1000,500", false, nil},
+		{"9 fields strict", "10,100,50,1000,500,1000,500,7,8", true, ErrFieldCount},
+		{"9 fields lenient", "10,100,50,1000,500,1000,500,7,8", false, nil},
+		{"6 fields lenient", "10,100,50,1000,500,1000", false, ErrFieldCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV([]byte(tt.body), parseOptions{strict: tt.strict})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err == nil && *got != want {
+				t.Errorf("stats = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestDetectAndParse(t *testing.T) {
+	want := Stats{10, 100, 50, 1000, 500, 1000, 500, 0}
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		prefix string
+	}{
+		{name: "csv", body: "10,100,50,1000,500,1000,500\n"},
+		{name: "json", body: `{"load":10,"mem_total":100,"mem_used":50,"disk_total":1000,"disk_used":500,"net_cap":1000,"net_used":500}`},
+		{name: "json with whitespace", body: "\n  {\"load\":10,\"mem_total\":100,\"mem_used\":50,\"disk_total\":1000,\"disk_used\":500,\"net_cap\":1000,\"net_used\":500}\n"},
+		{name: "neither", body: "<html>busy</html>", err: ErrFieldCount, prefix: "csv: "},
+		{name: "broken json", body: `{"load":`, err: ErrMalformedBody, prefix: "json: "},
+		{name: "empty", body: " \n", err: ErrEmptyBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectAndParse([]byte(tt.body), parseOptions{strict: true})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if !strings.HasPrefix(err.Error(), tt.prefix) {
+					t.Errorf("error %q does not name the format with %q", err, tt.prefix)
+				}
+				return
+			}
+			if *got != want {
+				t.Errorf("stats = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestParseCSVLines(t *testing.T) {
+	first := Stats{10, 100, 50, 1000, 500, 1000, 500, 0}
+	last := Stats{20, 100, 60, 1000, 600, 1000, 700, 0}
+	tests := []struct {
+		name     string
+		body     string
+		lastLine bool
+		want     Stats
+	}{
+		{"leading blank lines", "\n\n  \n10,100,50,1000,500,1000,500", false, first},
+		{"comment header", "# load,mem_total,mem_used,disk_total,disk_used,net_cap,net_used\n10,100,50,1000,500,1000,500", false, first},
+		{"trailing newlines", "10,100,50,1000,500,1000,500\n\n\n", false, first},
+		{"windows newlines", "# stats\r\n10,100,50,1000,500,1000,500\r\n", false, first},
+		{"header line", "load,mem_total,mem_used,disk_total,disk_used,net_cap,net_used\n10,100,50,1000,500,1000,500\n", false, first},
+		{"first sample", "10,100,50,1000,500,1000,500\n20,100,60,1000,600,1000,700\n", false, first},
+		{"last sample", "10,100,50,1000,500,1000,500\n20,100,60,1000,600,1000,700\n", true, last},
+		{"last sample before a comment", "# a\n10,100,50,1000,500,1000,500\n20,100,60,1000,600,1000,700\n# end\n\n", true, last},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV([]byte(tt.body), parseOptions{strict: true, lastLine: tt.lastLine})
+			if err != nil {
+				t.Fatalf("parseCSV: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("stats = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseCSV([]byte("# only a comment\n\n"), parseOptions{}); !errors.Is(err, ErrEmptyBody) {
+		t.Errorf("comment only body: error = %v, want %v", err, ErrEmptyBody)
+	}
+}
+
+func TestParseStatsRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		reason string
+	}{
+		{"valid", "10,100,100,1000,1000,1000,1000", nil, ""},
+		{"memory used over total", "10,100,101,1000,500,1000,500", ErrUsedOverTotal, "used_over_total"},
+		{"disk used over total", "10,100,50,1000,1001,1000,500", ErrUsedOverTotal, "used_over_total"},
+		{"network used over capacity", "10,100,50,1000,500,1000,1001", ErrUsedOverTotal, "used_over_total"},
+		{"absurd load average", "2000000,100,50,1000,500,1000,500", ErrLoadOutOfRange, "load_out_of_range"},
+		// zero totals are left to the evaluation of the enabled metrics
+		{"zero memory total", "10,0,0,1000,500,1000,500", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseStats([]byte(tt.body), csvParser{parseOptions{strict: true}})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got := parseErrorReason(err); got != tt.reason {
+				t.Errorf("reason = %q, want %q", got, tt.reason)
+			}
+		})
+	}
+}
+
+func FuzzParseStats(f *testing.F) {
+	for _, body := range []string{
+		"10,100,50,1000,500,1000,500",
+		"a,b,c,d,e,f,g",
+		"10,100,50",
+		"10,100,50,1000,500,1000,500,7,8",
+		`{"load":10,"mem_total":100,"mem_used":50,"disk_total":1000,"disk_used":500,"net_cap":1000,"net_used":500}`,
+	} {
+		f.Add([]byte(body))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		stats, err := parseStats(body, autoParser{parseOptions{strict: true}})
+		if err != nil {
+			return
+		}
+		if stats == nil {
+			t.Fatal("no stats and no error")
+		}
+		if err := validateStats(stats); err != nil {
+			t.Errorf("parsed stats %+v fail validation: %v", *stats, err)
+		}
+		for _, v := range []float64{stats.LoadAverage, stats.MemoryTotal, stats.MemoryUsed, stats.DiskTotal, stats.DiskUsed, stats.NetworkCapacity, stats.NetworkUsed} {
+			if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Errorf("parsed stats %+v hold %g", *stats, v)
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// savedMetric is the alert state of a metric kept across restarts.
+type savedMetric struct {
+	Severity   string    `json:"severity"`
+	LastAlert  time.Time `json:"last_alert"`
+	Suppressed bool      `json:"suppressed,omitempty"`
+	Since      time.Time `json:"since"`
+	Escalated  int       `json:"escalated,omitempty"`
+}
+
+// stateStore saves the breached metrics of every server to a JSON file,
+// so dedup and recoveries survive a restart.
+type stateStore struct {
+	mu      sync.Mutex
+	path    string
+	servers map[string]map[string]savedMetric
+}
+
+// loadStateStore reads the state file, a missing or corrupt one starts
+// with an empty state.
+func loadStateStore(path string) *stateStore {
+	s := &stateStore{path: path, servers: make(map[string]map[string]savedMetric)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &s.servers)
+	}
+	if err != nil {
+		slog.Warn("Unable to load alert state, starting fresh.", "file", path, "error", err)
+		s.servers = make(map[string]map[string]savedMetric)
+	}
+	return s
+}
+
+func (s *stateStore) get(server string) map[string]savedMetric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers[server]
+}
+
+// save replaces the state of server and writes the file, through a
+// temporary file so a crash never leaves it half written.
+func (s *stateStore) save(server string, metrics map[string]savedMetric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.servers[server] = metrics
+	data, err := json.MarshalIndent(s.servers, "", "  ")
+	if err == nil {
+		tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		slog.Error("Unable to save alert state.", "file", s.path, "error", err)
+	}
+}
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseQuietHours parses a "22:00-07:00" quiet hours window, it may
+// cross midnight.
+func parseQuietHours(s string) (MaintenanceWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return MaintenanceWindow{}, fmt.Errorf("invalid quiet-hours %q: must be HH:MM-HH:MM", s)
+	}
+	start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+	for _, v := range []string{start, end} {
+		if _, err := time.Parse(clockLayout, v); err != nil {
+			return MaintenanceWindow{}, fmt.Errorf("invalid quiet-hours %q: %w", s, err)
+		}
+	}
+	return MaintenanceWindow{Start: start, End: end, Daily: true}, nil
+}
+
+// inQuietHours reports whether now is in a quiet hours window, when
+// warnings only go to the log. The config is validated, so the windows
+// and the time zone parse.
+func (c *Config) inQuietHours(now time.Time) bool {
+	if len(c.QuietHours) == 0 {
+		return false
+	}
+	loc, _ := time.LoadLocation(c.QuietTZ)
+	for _, s := range c.QuietHours {
+		w, _ := parseQuietHours(s)
+		if ok, _ := w.contains(now.In(loc)); ok {
+			return true
+		}
+	}
+	return false
+}
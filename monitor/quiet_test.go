@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  MaintenanceWindow
+		valid bool
+	}{
+		{"22:00-07:00", MaintenanceWindow{Start: "22:00", End: "07:00", Daily: true}, true},
+		{" 09:30 - 18:00 ", MaintenanceWindow{Start: "09:30", End: "18:00", Daily: true}, true},
+		{"22:00", MaintenanceWindow{}, false},
+		{"22:00-25:00", MaintenanceWindow{}, false},
+		{"10pm-7am", MaintenanceWindow{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseQuietHours(tt.in)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("parseQuietHours(%q) = %+v, %v, want %+v, valid %t", tt.in, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	tests := []struct {
+		name  string
+		hours []string
+		tz    string
+		now   time.Time
+		want  bool
+	}{
+		{"no window", nil, "UTC", time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), false},
+		{"before midnight", []string{"22:00-07:00"}, "UTC", time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC), true},
+		{"after midnight", []string{"22:00-07:00"}, "UTC", time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), true},
+		{"at the start", []string{"22:00-07:00"}, "UTC", time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC), true},
+		{"at the end", []string{"22:00-07:00"}, "UTC", time.Date(2024, 1, 2, 7, 0, 0, 0, time.UTC), false},
+		{"daytime", []string{"22:00-07:00"}, "UTC", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), false},
+		{"same day window", []string{"12:00-14:00"}, "UTC", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC), true},
+		{"second window", []string{"22:00-07:00", "12:00-14:00"}, "UTC", time.Date(2024, 1, 1, 13, 59, 0, 0, time.UTC), true},
+		// 20:00 UTC is 23:00 in Moscow
+		{"quiet-tz in window", []string{"22:00-07:00"}, "Europe/Moscow", time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC), true},
+		{"quiet-tz out of window", []string{"22:00-07:00"}, "Europe/Moscow", time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC), false},
+		{"quiet-tz ignores the time zone of now", []string{"22:00-07:00"}, "UTC", time.Date(2024, 1, 1, 23, 0, 0, 0, msk), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.QuietHours = tt.hours
+			cfg.QuietTZ = tt.tz
+			if got := cfg.inQuietHours(tt.now); got != tt.want {
+				t.Errorf("inQuietHours(%v) = %t, want %t", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollOnceQuietHours(t *testing.T) {
+	// windows around now and away from it, either may cross midnight
+	now := time.Now().UTC()
+	around := now.Add(-time.Hour).Format(clockLayout) + "-" + now.Add(time.Hour).Format(clockLayout)
+	away := now.Add(2*time.Hour).Format(clockLayout) + "-" + now.Add(3*time.Hour).Format(clockLayout)
+	tests := []struct {
+		name     string
+		body     string
+		hours    string
+		code     int
+		messages []string
+	}{
+		{"warning out of the window", "25,100,50,1000,500,1000,500", away, ExitHealthy, []string{"Warning: Load Average is too high: 25"}},
+		{"warning in the window", "25,100,50,1000,500,1000,500", around, ExitHealthy, nil},
+		{"critical in the window", "45,100,50,1000,500,1000,500", around, ExitUnhealthy, []string{"Load Average is too high: 45"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(serveStats(t, http.StatusOK, tt.body).URL)
+			cfg.LoadAverageWarn = 20
+			cfg.QuietHours = stringList{tt.hours}
+			cfg.QuietTZ = "UTC"
+			code, messages, err := pollOnce(t, cfg)
+			if err != nil {
+				t.Fatalf("poll error: %v", err)
+			}
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			if !slices.Equal(messages, tt.messages) {
+				t.Errorf("messages = %q, want %q", messages, tt.messages)
+			}
+		})
+	}
+}
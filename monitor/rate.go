@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateWindow bounds the polls a breach rate window spans.
+const maxRateWindow = 1000
+
+// breachRate makes a metric breach once it was over its threshold in at
+// least count of the last window polls, instead of count polls in a row.
+// It recovers after count polls in a row back under it.
+type breachRate struct {
+	count  int
+	window int
+}
+
+// rateMetrics are the metrics a breach rate can be set for.
+var rateMetrics = []string{
+	metricLoadAverage, metricMemoryUsage, metricMemoryLeak, metricMemoryFree,
+	metricDiskUsage, metricDiskETA, metricDiskFree,
+	metricNetworkUsage, metricNetworkSpike,
+	metricHealthScore, metricFetchLatency,
+}
+
+// parseBreachRate parses "K/W" for every metric or "metric=K/W", it
+// returns the metric, empty for every one.
+func parseBreachRate(s string) (string, breachRate, error) {
+	metric, spec, ok := strings.Cut(s, "=")
+	if !ok {
+		metric, spec = "", s
+	}
+	metric = strings.TrimSpace(metric)
+	if metric != "" && !slices.Contains(rateMetrics, metric) {
+		return "", breachRate{}, fmt.Errorf("invalid breach-rate %q: unknown metric %s, must be one of %s", s, metric, strings.Join(rateMetrics, ", "))
+	}
+	k, w, ok := strings.Cut(spec, "/")
+	if !ok {
+		return "", breachRate{}, fmt.Errorf("invalid breach-rate %q: must be K/W or metric=K/W", s)
+	}
+	var r breachRate
+	var err error
+	if r.count, err = strconv.Atoi(strings.TrimSpace(k)); err != nil {
+		return "", breachRate{}, fmt.Errorf("invalid breach-rate %q: %w", s, err)
+	}
+	if r.window, err = strconv.Atoi(strings.TrimSpace(w)); err != nil {
+		return "", breachRate{}, fmt.Errorf("invalid breach-rate %q: %w", s, err)
+	}
+	if r.count < 1 || r.count > r.window || r.window > maxRateWindow {
+		return "", breachRate{}, fmt.Errorf("invalid breach-rate %q: must have 1 <= K <= W <= %d", s, maxRateWindow)
+	}
+	return metric, r, nil
+}
+
+// breachRate returns the breach rate of metric, the zero one when it
+// breaches on consecutive polls. A metric's own rate wins over the one
+// for every metric. The config is validated, so the rates parse.
+func (c *Config) breachRate(metric string) breachRate {
+	var all, own breachRate
+	for _, s := range c.BreachRate {
+		m, r, _ := parseBreachRate(s)
+		switch m {
+		case "":
+			all = r
+		case metric:
+			own = r
+		}
+	}
+	if own.window > 0 {
+		return own
+	}
+	return all
+}
+
+// updateRate is update for a rule with a breach rate. The metric breaches
+// once at least count of the samples in the window are over the threshold
+// and is alerted again like a consecutive breach on the next polls over it.
+// It only recovers after count polls in a row under threshold-band, so an
+// oscillating metric stays breached instead of flapping.
+func (s *alertState) updateRate(metric string, m *metricState, value float64, r alertRule, now time.Time) alertEvent {
+	w, ok := s.rates[metric]
+	if !ok || len(w.values) != r.rate.window {
+		w = &window{values: make([]float64, r.rate.window)}
+		s.rates[metric] = w
+	}
+	w.add(value)
+
+	isOver := func(v float64) bool { return v > r.threshold || r.inclusive && v == r.threshold }
+	if isOver(value) && w.count(isOver) >= r.rate.count {
+		if m.breached && r.cooldown > 0 && now.Sub(m.lastAlert) < r.cooldown {
+			return eventNone
+		}
+		if !m.breached {
+			m.since = now
+		}
+		m.breached = true
+		m.lastAlert = now
+		m.suppressed = false
+		s.dirty = true
+		return eventBreach
+	}
+
+	if !m.breached || w.len() < r.rate.count {
+		return eventNone
+	}
+	for _, v := range w.latest(r.rate.count) {
+		if v >= r.threshold-r.band {
+			return eventNone
+		}
+	}
+	*m = metricState{}
+	s.dirty = true
+	return eventRecover
+}
@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseBreachRate(t *testing.T) {
+	tests := []struct {
+		in     string
+		metric string
+		want   breachRate
+		valid  bool
+	}{
+		{"3/5", "", breachRate{3, 5}, true},
+		{"1/1", "", breachRate{1, 1}, true},
+		{"memory_usage=2/4", metricMemoryUsage, breachRate{2, 4}, true},
+		{" load_average = 3 / 10 ", metricLoadAverage, breachRate{3, 10}, true},
+		{"3", "", breachRate{}, false},
+		{"6/5", "", breachRate{}, false},
+		{"0/5", "", breachRate{}, false},
+		{"1/1001", "", breachRate{}, false},
+		{"x/5", "", breachRate{}, false},
+		{"cpu=3/5", "", breachRate{}, false},
+	}
+	for _, tt := range tests {
+		metric, got, err := parseBreachRate(tt.in)
+		if (err == nil) != tt.valid || metric != tt.metric || got != tt.want {
+			t.Errorf("parseBreachRate(%q) = %q, %+v, %v, want %q, %+v, valid %t", tt.in, metric, got, err, tt.metric, tt.want, tt.valid)
+		}
+	}
+
+	cfg := DefaultConfig()
+	if got := cfg.breachRate(metricMemoryUsage); got != (breachRate{}) {
+		t.Errorf("breachRate without -breach-rate = %+v, want none", got)
+	}
+	cfg.BreachRate = stringList{"memory_usage=2/4", "3/5"}
+	if got := cfg.breachRate(metricMemoryUsage); got != (breachRate{2, 4}) {
+		t.Errorf("breachRate(%s) = %+v, want its own 2/4", metricMemoryUsage, got)
+	}
+	if got := cfg.breachRate(metricLoadAverage); got != (breachRate{3, 5}) {
+		t.Errorf("breachRate(%s) = %+v, want the 3/5 of every metric", metricLoadAverage, got)
+	}
+}
+
+func TestUpdateRate(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 1, rate: breachRate{count: 3, window: 5}}
+	const n, b, r = eventNone, eventBreach, eventRecover
+	tests := []struct {
+		name   string
+		values []float64
+		want   []alertEvent
+	}{
+		{
+			name:   "window filling up",
+			values: []float64{90, 90, 90},
+			want:   []alertEvent{n, n, b},
+		},
+		{
+			name:   "intermittent breaches",
+			values: []float64{90, 70, 90, 70, 90},
+			want:   []alertEvent{n, n, n, n, b},
+		},
+		{
+			name:   "breaches spread over more than the window",
+			values: []float64{90, 70, 70, 70, 70, 90, 70, 70, 90},
+			want:   []alertEvent{n, n, n, n, n, n, n, n, n},
+		},
+		{
+			name:   "rate falling back under K",
+			values: []float64{90, 90, 90, 70, 70, 70},
+			want:   []alertEvent{n, n, b, n, n, r},
+		},
+		{
+			name:   "recovery reset inside the band",
+			values: []float64{90, 90, 90, 70, 78, 70, 70, 70},
+			want:   []alertEvent{n, n, b, n, n, n, n, r},
+		},
+		{
+			name:   "recovery reset by a breach",
+			values: []float64{90, 90, 90, 70, 70, 90, 70, 70, 70},
+			want:   []alertEvent{n, n, b, n, n, b, n, n, r},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feed(newAlertState(), rule, tt.values...); !slices.Equal(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRateOscillating(t *testing.T) {
+	values := []float64{90, 70, 90, 70, 90, 70, 90, 70, 90, 70}
+
+	// three polls in a row never come
+	consecutive := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 3}
+	for i, e := range feed(newAlertState(), consecutive, values...) {
+		if e != eventNone {
+			t.Fatalf("consecutive count: poll %d = %v, want %v", i, e, eventNone)
+		}
+	}
+
+	// three of the last five do, and the polls under the threshold alone
+	// never recover
+	rate := consecutive
+	rate.rate = breachRate{count: 3, window: 5}
+	s := newAlertState()
+	const n, b = eventNone, eventBreach
+	want := []alertEvent{n, n, n, n, b, n, b, n, b, n}
+	if got := feed(s, rate, values...); !slices.Equal(got, want) {
+		t.Errorf("breach rate: events = %v, want %v", got, want)
+	}
+	if !s.breached(metricMemoryUsage) {
+		t.Error("metric is not breached after oscillating around the threshold")
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"reflect"
+	"sort"
+)
+
+// staticFields lists the settings that are only applied at startup.
+func (c *Config) staticFields() map[string]any {
+	return map[string]any{
+		"config":                     &c.ConfigFile,
+		"once":                       &c.Once,
+		"dry-run":                    &c.DryRun,
+		"url":                        &c.StatsURLs,
+		"failover":                   &c.Failover,
+		"banner":                     &c.Banner,
+		"source":                     &c.Source,
+		"state-file":                 &c.StateFile,
+		"timeout":                    &c.HTTPTimeout,
+		"header":                     &c.Headers,
+		"ca-file":                    &c.CAFile,
+		"cert-file":                  &c.CertFile,
+		"key-file":                   &c.KeyFile,
+		"insecure-skip-verify":       &c.InsecureSkipVerify,
+		"proxy":                      &c.Proxy,
+		"resolve":                    &c.Resolve,
+		"max-redirects":              &c.MaxRedirects,
+		"metrics-addr":               &c.MetricsAddr,
+		"health-addr":                &c.HealthAddr,
+		"statsd-addr":                &c.StatsdAddr,
+		"statsd-prefix":              &c.StatsdPrefix,
+		"graphite-addr":              &c.GraphiteAddr,
+		"graphite-prefix":            &c.GraphitePrefix,
+		"influx-url":                 &c.InfluxURL,
+		"influx-token":               &c.InfluxToken,
+		"influx-org":                 &c.InfluxOrg,
+		"influx-bucket":              &c.InfluxBucket,
+		"otlp-endpoint":              &c.OTLPEndpoint,
+		"otlp-insecure":              &c.OTLPInsecure,
+		"log-format":                 &c.LogFormat,
+		"log-output":                 &c.LogOutput,
+		"timestamps":                 &c.Timestamps,
+		"tz":                         &c.TZ,
+		"color":                      &c.Color,
+		"log-level":                  &c.LogLevel,
+		"log-file":                   &c.LogFile,
+		"log-max-size":               &c.LogMaxSize,
+		"log-max-backups":            &c.LogMaxBackups,
+		"log-echo":                   &c.LogEcho,
+		"slack-webhook":              &c.SlackWebhook,
+		"discord-webhook":            &c.DiscordWebhook,
+		"teams-webhook":              &c.TeamsWebhook,
+		"telegram-token":             &c.TelegramToken,
+		"telegram-chat-id":           &c.TelegramChatID,
+		"pagerduty-routing-key":      &c.PagerDutyKey,
+		"telegram-token-file":        &c.TelegramTokenFile,
+		"pagerduty-routing-key-file": &c.PagerDutyKeyFile,
+		"influx-token-file":          &c.InfluxTokenFile,
+		"slack-webhook-file":         &c.SlackWebhookFile,
+		"discord-webhook-file":       &c.DiscordWebhookFile,
+		"teams-webhook-file":         &c.TeamsWebhookFile,
+		"webhook-url":                &c.WebhookURL,
+		"webhook-template":           &c.WebhookTemplate,
+		"coalesce":                   &c.CoalesceWindow,
+		"notify-retries":             &c.NotifyRetries,
+		"notify-backoff":             &c.NotifyBackoff,
+		"notify-queue-size":          &c.NotifyQueueSize,
+		"deadletter-file":            &c.DeadLetterFile,
+		"notify-workers":             &c.NotifyWorkers,
+		"notify-buffer":              &c.NotifyBuffer,
+		"notify-block":               &c.NotifyBlock,
+		"syslog-addr":                &c.SyslogAddr,
+		"syslog-network":             &c.SyslogNetwork,
+		"escalate":                   &c.Escalate,
+	}
+}
+
+// keepStatic copies the startup-only settings from prev into c and
+// returns the names of those that were changed.
+func (c *Config) keepStatic(prev *Config) []string {
+	var ignored []string
+	cur, old := c.staticFields(), prev.staticFields()
+	for name, field := range cur {
+		v, prevV := reflect.ValueOf(field).Elem(), reflect.ValueOf(old[name]).Elem()
+		if !reflect.DeepEqual(v.Interface(), prevV.Interface()) {
+			ignored = append(ignored, name)
+		}
+		v.Set(prevV)
+	}
+	sort.Strings(ignored)
+	return ignored
+}
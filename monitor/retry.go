@@ -0,0 +1,282 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// default notification retry settings
+	notifyBackoff   = 5 * time.Second
+	notifyQueueSize = 100
+
+	maxNotifyBackoff = 10 * time.Minute
+)
+
+type retryItem struct {
+	alert    Alert
+	attempts int
+	due      time.Time
+	err      error
+}
+
+// retryNotifier queues the alerts next failed to send and retries them
+// with exponential backoff. Those that run out of retries, are pushed out
+// of the full queue or are still queued at shutdown go to the dead-letter
+// file when one is set.
+type retryNotifier struct {
+	name       string
+	next       Notifier
+	retries    int
+	backoff    time.Duration
+	size       int
+	deadLetter string
+
+	mu     sync.Mutex
+	queue  []retryItem
+	closed bool
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newRetryNotifier(name string, next Notifier, cfg *Config) *retryNotifier {
+	n := &retryNotifier{
+		name:       name,
+		next:       next,
+		retries:    cfg.NotifyRetries,
+		backoff:    cfg.NotifyBackoff,
+		size:       cfg.NotifyQueueSize,
+		deadLetter: cfg.DeadLetterFile,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify returns the error of the first attempt, so that it is logged
+// like any other failed notification.
+func (n *retryNotifier) Notify(ctx context.Context, a Alert) error {
+	err := n.next.Notify(ctx, a)
+	if err != nil {
+		n.enqueue(retryItem{alert: a, attempts: 1, err: err})
+	}
+	return err
+}
+
+func (n *retryNotifier) enqueue(item retryItem) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		n.writeDeadLetter(item)
+		return
+	}
+	if item.attempts > n.retries {
+		n.mu.Unlock()
+		if n.retries > 0 {
+			slog.Error("Notification dropped after retries.", "notifier", n.name, "attempts", item.attempts, "error", item.err)
+		}
+		n.writeDeadLetter(item)
+		return
+	}
+
+	var dropped []retryItem
+	if len(n.queue) >= n.size {
+		dropped = n.queue[:len(n.queue)-n.size+1]
+		n.queue = n.queue[len(dropped):]
+	}
+	item.due = time.Now().Add(n.delay(item.attempts))
+	n.queue = append(n.queue, item)
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	for _, d := range dropped {
+		slog.Warn("Notification retry queue full, dropping the oldest.", "notifier", n.name, "size", n.size)
+		n.writeDeadLetter(d)
+	}
+}
+
+// delay is the backoff before the retry after the given attempt.
+func (n *retryNotifier) delay(attempts int) time.Duration {
+	d := n.backoff
+	for i := 1; i < attempts; i++ {
+		d = min(2*d, maxNotifyBackoff)
+	}
+	return d
+}
+
+func (n *retryNotifier) run() {
+	defer close(n.stopped)
+	for {
+		item, wait, ok := n.pop(time.Now())
+		if ok {
+			n.retry(item)
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-n.done:
+			timer.Stop()
+			return
+		case <-n.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// pop removes the first item due at now, or returns how long to wait
+// for the next one.
+func (n *retryNotifier) pop(now time.Time) (retryItem, time.Duration, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	wait := time.Hour
+	for i, item := range n.queue {
+		if !item.due.After(now) {
+			n.queue = append(n.queue[:i], n.queue[i+1:]...)
+			return item, 0, true
+		}
+		wait = min(wait, item.due.Sub(now))
+	}
+	return retryItem{}, wait, false
+}
+
+func (n *retryNotifier) retry(item retryItem) {
+	item.attempts++
+	item.err = n.next.Notify(context.Background(), item.alert)
+	if item.err != nil {
+		n.enqueue(item)
+		return
+	}
+	slog.Info("Notification sent after retries.", "notifier", n.name, "attempts", item.attempts)
+}
+
+type deadLetter struct {
+	Time      time.Time `json:"time"`
+	Notifier  string    `json:"notifier"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Severity  string    `json:"severity"`
+	Server    string    `json:"server"`
+	Message   string    `json:"message"`
+	Recovered bool      `json:"recovered"`
+	AlertTime time.Time `json:"alert_time"`
+}
+
+// writeDeadLetter appends the item to the dead-letter file as a JSON
+// line. The file is opened for every write, dead letters are rare.
+func (n *retryNotifier) writeDeadLetter(item retryItem) {
+	if n.deadLetter == "" {
+		return
+	}
+	a := item.alert
+	line, err := json.Marshal(deadLetter{
+		Time:      time.Now(),
+		Notifier:  n.name,
+		Attempts:  item.attempts,
+		Error:     item.err.Error(),
+		Metric:    a.Metric,
+		Value:     a.Value,
+		Threshold: a.Threshold,
+		Severity:  a.Severity,
+		Server:    a.Server,
+		Message:   a.Message,
+		Recovered: a.Recovered,
+		AlertTime: a.Time,
+	})
+	if err == nil {
+		err = appendLine(n.deadLetter, line)
+	}
+	if err != nil {
+		slog.Error("Unable to write dead letter.", "file", n.deadLetter, "notifier", n.name, "error", err)
+	}
+}
+
+func appendLine(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// createFile creates path unless it exists, leaving it empty.
+func createFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkAppendable reports whether lines can be appended to path without
+// creating it. An existing file has to open for writing, a missing one
+// needs a writable directory.
+func checkAppendable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return dirWritable(dir)
+}
+
+// Close stops the retries, waiting for one in flight, and moves the
+// queued alerts to the dead-letter file.
+func (n *retryNotifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	n.mu.Unlock()
+
+	close(n.done)
+	<-n.stopped
+
+	n.mu.Lock()
+	queue := n.queue
+	n.queue = nil
+	n.mu.Unlock()
+	if len(queue) > 0 {
+		slog.Warn("Notifications still queued for retry at shutdown.", "notifier", n.name, "count", len(queue))
+	}
+	for _, item := range queue {
+		n.writeDeadLetter(item)
+	}
+	return closeNotifier(n.next)
+}
@@ -0,0 +1,36 @@
+package monitor
+
+// metricHealthScore is the composite score alerted on with -health-floor.
+const metricHealthScore = "health_score"
+
+// scorePart is a metric value with the critical threshold and weight it
+// counts toward the health score with.
+type scorePart struct {
+	value     float64
+	threshold float64
+	weight    float64
+}
+
+// healthScore combines the metrics into a 0-100 score, 100 being idle
+// and 0 every metric at or over its threshold:
+//
+//	headroom = clamp(1 - value/threshold, 0, 1)
+//	score    = 100 * sum(weight * headroom) / sum(weight)
+//
+// Metrics with a zero weight or threshold are left out. ok is false when
+// none is left.
+func healthScore(parts []scorePart) (score float64, ok bool) {
+	var sum, weights float64
+	for _, p := range parts {
+		if p.weight <= 0 || p.threshold <= 0 {
+			continue
+		}
+		headroom := min(max(1-p.value/p.threshold, 0), 1)
+		sum += p.weight * headroom
+		weights += p.weight
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return 100 * sum / weights, true
+}
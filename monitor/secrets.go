@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// secret is a setting that can also be read from a file, the way
+// container secrets are mounted.
+type secret struct {
+	name  string
+	value *string
+	file  *string
+	// env is empty for the secrets without an env fallback
+	env string
+}
+
+func (c *Config) secrets() []secret {
+	return []secret{
+		{"auth-token", &c.AuthToken, &c.AuthTokenFile, authTokenEnv},
+		{"auth-pass", &c.AuthPass, &c.AuthPassFile, ""},
+		{"telegram-token", &c.TelegramToken, &c.TelegramTokenFile, telegramTokenEnv},
+		{"pagerduty-routing-key", &c.PagerDutyKey, &c.PagerDutyKeyFile, pagerDutyKeyEnv},
+		{"influx-token", &c.InfluxToken, &c.InfluxTokenFile, influxTokenEnv},
+		{"slack-webhook", &c.SlackWebhook, &c.SlackWebhookFile, ""},
+		{"discord-webhook", &c.DiscordWebhook, &c.DiscordWebhookFile, ""},
+		{"teams-webhook", &c.TeamsWebhook, &c.TeamsWebhookFile, ""},
+	}
+}
+
+// readSecrets resolves the secrets: the -<name>-file contents win over
+// the env variable, which wins over the flag and config file value.
+// Trailing newlines are trimmed from the files.
+func (c *Config) readSecrets() error {
+	for _, s := range c.secrets() {
+		if *s.file != "" {
+			data, err := os.ReadFile(*s.file)
+			if err != nil {
+				return fmt.Errorf("invalid %s-file: %w", s.name, err)
+			}
+			*s.value = strings.TrimRight(string(data), "\r\n")
+			continue
+		}
+		if v := os.Getenv(s.env); s.env != "" && v != "" {
+			*s.value = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const serverShutdownTimeout = 5 * time.Second
+
+// routes groups handlers by listen address, so that endpoints
+// configured with the same address share one server.
+type routes map[string]*http.ServeMux
+
+func (r routes) handle(addr, pattern string, handler http.Handler) {
+	if addr == "" {
+		return
+	}
+	mux, ok := r[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		r[addr] = mux
+	}
+	mux.Handle(pattern, handler)
+}
+
+// serveHTTP runs an HTTP server on addr until ctx is cancelled.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	srv := &http.Server{Addr: addr, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP server failed.", "addr", addr, "error", err)
+	}
+}
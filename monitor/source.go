@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// stdinSource is the -source value reading the stats from stdin.
+const stdinSource = "-"
+
+// fileSource reads the stats body from a file on every poll. Stdin can be
+// read only once, so its body is kept and replayed on the next polls.
+type fileSource struct {
+	path string
+
+	once  sync.Once
+	stdin []byte
+	err   error
+}
+
+func newFileSource(raw string) (*fileSource, error) {
+	if raw == stdinSource {
+		return &fileSource{}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source: %w", err)
+	}
+	if u.Scheme != "file" || u.Path == "" || u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("invalid source %q: must be - or a file:///path URL", raw)
+	}
+	return &fileSource{path: u.Path}, nil
+}
+
+func (s *fileSource) read() ([]byte, error) {
+	if s.path != "" {
+		return os.ReadFile(s.path)
+	}
+	s.once.Do(func() {
+		s.stdin, s.err = io.ReadAll(os.Stdin)
+	})
+	return s.stdin, s.err
+}
@@ -0,0 +1,385 @@
+package monitor
+
+import (
+	"math"
+	"time"
+)
+
+// diskHistorySize is the number of disk samples the fill rate is computed from.
+const diskHistorySize = 12
+
+// leakNoise is how far memory usage may dip, in percentage points, and
+// still count as growing.
+const leakNoise = 1
+
+type alertEvent int
+
+const (
+	eventNone alertEvent = iota
+	eventBreach
+	eventRecover
+)
+
+// alertRule holds the alerting settings applied to a metric.
+type alertRule struct {
+	threshold float64
+	severity  string
+	// below makes the metric breach under the threshold instead of over it
+	below bool
+	// inclusive makes a value equal to the threshold breach it
+	inclusive bool
+	// band is how far under the threshold a breached metric
+	// has to drop before it is considered recovered
+	band float64
+	// count is how many consecutive polls a metric has to stay
+	// over the threshold to breach, or under it to recover
+	count int
+	// rate replaces count with a breach rate when its window is set
+	rate     breachRate
+	cooldown time.Duration
+}
+
+type metricState struct {
+	severity  string
+	breached  bool
+	lastAlert time.Time
+	// the breach alert was held back by a maintenance window
+	suppressed bool
+	// since is when the breach started, escalated counts the rungs of the
+	// escalation ladder it reached
+	since     time.Time
+	escalated int
+	// consecutive polls over the threshold and under the recovery boundary
+	over  int
+	under int
+}
+
+// alertState carries per-metric alert state between polls.
+type alertState struct {
+	// dirty is set when a breach starts, is alerted or ends
+	dirty   bool
+	metrics map[string]*metricState
+	samples map[string]*window
+	// rates holds the latest samples of the metrics with a breach rate
+	rates map[string]*window
+	disk  []diskSample
+	// memory usage samples since it last dropped
+	memory []float64
+	// the network bandwidth used at the previous poll
+	netUsed    float64
+	netSampled bool
+}
+
+type diskSample struct {
+	time time.Time
+	used float64
+}
+
+func newAlertState() *alertState {
+	return &alertState{
+		metrics: make(map[string]*metricState),
+		samples: make(map[string]*window),
+		rates:   make(map[string]*window),
+	}
+}
+
+// window is a ring buffer of the latest metric samples.
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func (w *window) add(v float64) {
+	w.values[w.next] = v
+	w.next = (w.next + 1) % len(w.values)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// len is the number of samples in the window.
+func (w *window) len() int {
+	if w.full {
+		return len(w.values)
+	}
+	return w.next
+}
+
+func (w *window) mean() float64 {
+	sum := 0.0
+	for _, v := range w.values[:w.len()] {
+		sum += v
+	}
+	return sum / float64(w.len())
+}
+
+// latest returns the n most recent samples, n is at most len.
+func (w *window) latest(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = w.values[(w.next-1-i+len(w.values))%len(w.values)]
+	}
+	return out
+}
+
+// count returns how many samples in the window match.
+func (w *window) count(match func(float64) bool) int {
+	n := 0
+	for _, v := range w.values[:w.len()] {
+		if match(v) {
+			n++
+		}
+	}
+	return n
+}
+
+// smooth records a sample and returns the moving average of the last size
+// samples, or of those collected so far while the window is filling up.
+func (s *alertState) smooth(metric string, value float64, size int) float64 {
+	if size <= 1 {
+		return value
+	}
+	w, ok := s.samples[metric]
+	if !ok || len(w.values) != size {
+		w = &window{values: make([]float64, size)}
+		s.samples[metric] = w
+	}
+	w.add(value)
+	return w.mean()
+}
+
+// update records the metric value and returns the event to notify about.
+// A breach fires after count consecutive polls above the threshold, or at
+// it when the rule is inclusive, but only clears after count consecutive
+// polls below threshold-band, so a value hovering around the threshold
+// doesn't flap. A repeated breach is
+// suppressed until the cooldown elapses, a zero cooldown disables
+// suppression. The poll that clears a breach yields a recovery. A rule
+// with a breach rate is evaluated by updateRate instead.
+func (s *alertState) update(metric string, value float64, r alertRule, now time.Time) alertEvent {
+	m, ok := s.metrics[metric]
+	if !ok {
+		m = &metricState{}
+		s.metrics[metric] = m
+	}
+	m.severity = r.severity
+
+	if r.below {
+		value, r.threshold = -value, -r.threshold
+	}
+	if r.rate.window > 0 {
+		return s.updateRate(metric, m, value, r, now)
+	}
+
+	if value > r.threshold || r.inclusive && value == r.threshold {
+		m.under = 0
+		m.over++
+		if m.over < r.count {
+			return eventNone
+		}
+		if m.breached && r.cooldown > 0 && now.Sub(m.lastAlert) < r.cooldown {
+			return eventNone
+		}
+		if !m.breached {
+			m.since = now
+		}
+		m.breached = true
+		m.lastAlert = now
+		m.suppressed = false
+		s.dirty = true
+		return eventBreach
+	}
+
+	m.over = 0
+	if !m.breached {
+		return eventNone
+	}
+	if value >= r.threshold-r.band {
+		m.under = 0
+		return eventNone
+	}
+	m.under++
+	if m.under < r.count {
+		return eventNone
+	}
+	*m = metricState{}
+	s.dirty = true
+	return eventRecover
+}
+
+// suppress marks the breach of metric as not sent, so it is alerted
+// again on the next poll regardless of the cooldown.
+func (s *alertState) suppress(metric string) {
+	if m, ok := s.metrics[metric]; ok {
+		m.suppressed = true
+		m.lastAlert = time.Time{}
+		s.dirty = true
+	}
+}
+
+func (s *alertState) suppressed(metric string) bool {
+	m, ok := s.metrics[metric]
+	return ok && m.suppressed
+}
+
+// escalate returns when the breach of metric started and the rungs it
+// reached since the last call. A breach held back by a maintenance window
+// is not escalated.
+func (s *alertState) escalate(metric string, rungs []escalation, now time.Time) (time.Time, []escalation) {
+	m, ok := s.metrics[metric]
+	if !ok || !m.breached || m.suppressed {
+		return time.Time{}, nil
+	}
+	// a breach restored from an older state file starts now
+	if m.since.IsZero() {
+		m.since = now
+		s.dirty = true
+	}
+	// the ladder may have been shortened since the state was saved
+	m.escalated = min(m.escalated, len(rungs))
+	start := m.escalated
+	for m.escalated < len(rungs) && now.Sub(m.since) >= rungs[m.escalated].after {
+		m.escalated++
+		s.dirty = true
+	}
+	return m.since, rungs[start:m.escalated]
+}
+
+// escalated returns how many rungs of the escalation ladder the breach
+// of metric reached.
+func (s *alertState) escalated(metric string) int {
+	if m, ok := s.metrics[metric]; ok {
+		return m.escalated
+	}
+	return 0
+}
+
+// forget drops the alert state of disabled metrics.
+func (s *alertState) forget(metrics ...string) {
+	for _, metric := range metrics {
+		delete(s.metrics, metric)
+		delete(s.metrics, warnKey(metric))
+		delete(s.samples, metric)
+		delete(s.rates, metric)
+		delete(s.rates, warnKey(metric))
+	}
+}
+
+// saved returns the breached metrics to persist and clears dirty.
+func (s *alertState) saved() map[string]savedMetric {
+	s.dirty = false
+	out := make(map[string]savedMetric)
+	for metric, m := range s.metrics {
+		if m.breached {
+			out[metric] = savedMetric{Severity: m.severity, LastAlert: m.lastAlert, Suppressed: m.suppressed, Since: m.since, Escalated: m.escalated}
+		}
+	}
+	return out
+}
+
+// restore marks the saved metrics as breached.
+func (s *alertState) restore(saved map[string]savedMetric) {
+	for metric, sm := range saved {
+		s.metrics[metric] = &metricState{
+			severity:   sm.Severity,
+			breached:   true,
+			lastAlert:  sm.LastAlert,
+			suppressed: sm.Suppressed,
+			since:      sm.Since,
+			escalated:  sm.Escalated,
+		}
+	}
+}
+
+// warnKey is the state key of a metric warning level.
+func warnKey(metric string) string {
+	return metric + "/" + severityWarning
+}
+
+func (s *alertState) breached(metric string) bool {
+	m, ok := s.metrics[metric]
+	return ok && m.breached
+}
+
+// breachedMetrics lists the metrics over their critical threshold.
+func (s *alertState) breachedMetrics() []string {
+	var out []string
+	for _, metric := range sortedKeys(s.metrics) {
+		if m := s.metrics[metric]; m.breached && m.severity == severityCritical {
+			out = append(out, metric)
+		}
+	}
+	return out
+}
+
+// memoryRise records a memory usage sample and returns how much the usage
+// grew over the last polls samples, or 0 while fewer have been taken since
+// it last dropped by more than the noise.
+func (s *alertState) memoryRise(usage float64, polls int) float64 {
+	if n := len(s.memory); n > 0 && usage < s.memory[n-1]-leakNoise {
+		s.memory = s.memory[:0]
+	}
+	s.memory = append(s.memory, usage)
+	if len(s.memory) > polls+1 {
+		s.memory = s.memory[len(s.memory)-polls-1:]
+	}
+	if len(s.memory) <= polls {
+		return 0
+	}
+	return s.memory[polls] - s.memory[0]
+}
+
+// networkSpike records the used bandwidth and returns by how many percent
+// it grew since the previous poll, 0 on the first poll or when it fell or
+// was zero.
+func (s *alertState) networkSpike(used float64) float64 {
+	prev, sampled := s.netUsed, s.netSampled
+	s.netUsed, s.netSampled = used, true
+	if !sampled || prev == 0 || used <= prev {
+		return 0
+	}
+	return (used - prev) / prev * 100
+}
+
+// diskETA records a disk sample and projects the time left until the disk
+// is full from the linear fill rate over the recent samples. Flat or
+// decreasing usage never fills the disk and yields the max duration.
+func (s *alertState) diskETA(used, total float64, now time.Time) time.Duration {
+	s.disk = append(s.disk, diskSample{time: now, used: used})
+	if len(s.disk) > diskHistorySize {
+		s.disk = s.disk[len(s.disk)-diskHistorySize:]
+	}
+	if len(s.disk) < 2 {
+		return math.MaxInt64
+	}
+
+	// least squares slope of used bytes over seconds
+	var sumT, sumU, sumTT, sumTU float64
+	for _, d := range s.disk {
+		t := d.time.Sub(s.disk[0].time).Seconds()
+		sumT += t
+		sumU += d.used
+		sumTT += t * t
+		sumTU += t * d.used
+	}
+	n := float64(len(s.disk))
+	denom := n*sumTT - sumT*sumT
+	if denom == 0 {
+		return math.MaxInt64
+	}
+	rate := (n*sumTU - sumT*sumU) / denom
+	if rate <= 0 {
+		return math.MaxInt64
+	}
+
+	free := total - used
+	if free <= 0 {
+		return 0
+	}
+	secs := free / rate
+	if secs >= float64(math.MaxInt64)/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(secs * float64(time.Second))
+}
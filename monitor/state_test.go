@@ -0,0 +1,248 @@
+package monitor
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock the tests move forward by hand, its now method
+// fits logClock.now.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// feed updates the metric with values polled a second apart and returns
+// the events of each poll.
+func feed(s *alertState, rule alertRule, values ...float64) []alertEvent {
+	clock := newFakeClock()
+	events := make([]alertEvent, len(values))
+	for i, v := range values {
+		events[i] = s.update(metricMemoryUsage, v, rule, clock.now())
+		clock.advance(time.Second)
+	}
+	return events
+}
+
+func TestUpdateHysteresis(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 1}
+	tests := []struct {
+		name   string
+		values []float64
+		want   []alertEvent
+	}{
+		{
+			name:   "inside the band",
+			values: []float64{82, 76, 75},
+			want:   []alertEvent{eventBreach, eventNone, eventNone},
+		},
+		{
+			name:   "under the band",
+			values: []float64{82, 74.9, 82},
+			want:   []alertEvent{eventBreach, eventRecover, eventBreach},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feed(newAlertState(), rule, tt.values...); !slices.Equal(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateInclusive(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     float64
+		below     bool
+		inclusive bool
+		want      alertEvent
+	}{
+		{"strict at the threshold", 80, false, false, eventNone},
+		{"strict over the threshold", 80.01, false, false, eventBreach},
+		{"inclusive at the threshold", 80, false, true, eventBreach},
+		{"inclusive under the threshold", 79.99, false, true, eventNone},
+		{"strict minimum at the threshold", 80, true, false, eventNone},
+		{"inclusive minimum at the threshold", 80, true, true, eventBreach},
+		{"inclusive minimum over the threshold", 80.01, true, true, eventNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := alertRule{threshold: 80, severity: severityCritical, below: tt.below, inclusive: tt.inclusive, count: 1}
+			if got := feed(newAlertState(), rule, tt.value); got[0] != tt.want {
+				t.Errorf("event = %v, want %v", got[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateHysteresisNoFlapping(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 1}
+	s := newAlertState()
+	for i, e := range feed(s, rule, 82, 78, 81, 79, 82, 78, 80, 78) {
+		if e == eventRecover {
+			t.Fatalf("poll %d recovered while oscillating by 2 around the threshold", i)
+		}
+	}
+	if !s.breached(metricMemoryUsage) {
+		t.Error("metric is not breached after oscillating around the threshold")
+	}
+}
+
+func TestUpdateBreachCount(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 3}
+	tests := []struct {
+		name   string
+		values []float64
+		want   []alertEvent
+	}{
+		{
+			name:   "single spike",
+			values: []float64{90, 70, 70},
+			want:   []alertEvent{eventNone, eventNone, eventNone},
+		},
+		{
+			name:   "consecutive breaches",
+			values: []float64{90, 90, 90, 90},
+			want:   []alertEvent{eventNone, eventNone, eventBreach, eventBreach},
+		},
+		{
+			name:   "reset under the threshold",
+			values: []float64{90, 90, 70, 90, 90, 90},
+			want:   []alertEvent{eventNone, eventNone, eventNone, eventNone, eventNone, eventBreach},
+		},
+		{
+			name:   "consecutive recoveries",
+			values: []float64{90, 90, 90, 70, 70, 70},
+			want:   []alertEvent{eventNone, eventNone, eventBreach, eventNone, eventNone, eventRecover},
+		},
+		{
+			name:   "recovery reset by a breach",
+			values: []float64{90, 90, 90, 70, 70, 90, 70, 70, 70},
+			want:   []alertEvent{eventNone, eventNone, eventBreach, eventNone, eventNone, eventNone, eventNone, eventNone, eventRecover},
+		},
+		{
+			name:   "recovery reset inside the band",
+			values: []float64{90, 90, 90, 70, 78, 70, 70, 70},
+			want:   []alertEvent{eventNone, eventNone, eventBreach, eventNone, eventNone, eventNone, eventNone, eventRecover},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feed(newAlertState(), rule, tt.values...); !slices.Equal(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateCooldown(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 1, cooldown: time.Minute}
+	s, clock := newAlertState(), newFakeClock()
+	steps := []struct {
+		after time.Duration
+		value float64
+		want  alertEvent
+	}{
+		{0, 90, eventBreach},
+		{30 * time.Second, 90, eventNone},
+		{29 * time.Second, 90, eventNone},
+		{time.Second, 90, eventBreach},
+		{10 * time.Second, 70, eventRecover},
+		// a new breach isn't held back by the cooldown of the last one
+		{10 * time.Second, 90, eventBreach},
+	}
+	for i, st := range steps {
+		clock.advance(st.after)
+		if got := s.update(metricMemoryUsage, st.value, rule, clock.now()); got != st.want {
+			t.Errorf("step %d at %v: event = %v, want %v", i, clock.now().Format(time.TimeOnly), got, st.want)
+		}
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, count: 1}
+	rungs := []escalation{
+		{severity: severityCritical, after: 5 * time.Minute, notifier: "slack"},
+		{severity: severityCritical, after: 15 * time.Minute, notifier: "pagerduty"},
+	}
+	s, clock := newAlertState(), newFakeClock()
+	start := clock.now()
+	s.update(metricMemoryUsage, 90, rule, clock.now())
+
+	steps := []struct {
+		after time.Duration
+		want  []string
+	}{
+		{time.Minute, nil},
+		{4 * time.Minute, []string{"slack"}},
+		{time.Minute, nil},
+		{10 * time.Minute, []string{"pagerduty"}},
+		{time.Hour, nil},
+	}
+	for i, st := range steps {
+		clock.advance(st.after)
+		since, due := s.escalate(metricMemoryUsage, rungs, clock.now())
+		if !since.Equal(start) {
+			t.Errorf("step %d: since = %v, want %v", i, since, start)
+		}
+		var got []string
+		for _, e := range due {
+			got = append(got, e.notifier)
+		}
+		if !slices.Equal(got, st.want) {
+			t.Errorf("step %d after %v: escalated to %q, want %q", i, clock.now().Sub(start), got, st.want)
+		}
+	}
+	if got := s.escalated(metricMemoryUsage); got != len(rungs) {
+		t.Errorf("escalated = %d, want %d", got, len(rungs))
+	}
+}
+
+func TestEscalateAfterRecovery(t *testing.T) {
+	rule := alertRule{threshold: 80, severity: severityCritical, band: 5, count: 2}
+	rungs := []escalation{{severity: severityCritical, after: 5 * time.Minute, notifier: "slack"}}
+	s, clock := newAlertState(), newFakeClock()
+
+	// the breach starts at the second poll over the threshold
+	s.update(metricMemoryUsage, 90, rule, clock.now())
+	clock.advance(time.Minute)
+	s.update(metricMemoryUsage, 90, rule, clock.now())
+	start := clock.now()
+	clock.advance(5 * time.Minute)
+	if since, due := s.escalate(metricMemoryUsage, rungs, clock.now()); !since.Equal(start) || len(due) != 1 {
+		t.Fatalf("escalate = %v, %v, want %v and one rung", since, due, start)
+	}
+
+	// a single poll under the threshold doesn't recover
+	clock.advance(time.Minute)
+	if got := s.update(metricMemoryUsage, 70, rule, clock.now()); got != eventNone {
+		t.Fatalf("first poll under the threshold: event = %v, want %v", got, eventNone)
+	}
+	clock.advance(time.Minute)
+	if got := s.update(metricMemoryUsage, 70, rule, clock.now()); got != eventRecover {
+		t.Fatalf("second poll under the threshold: event = %v, want %v", got, eventRecover)
+	}
+	if got := s.escalated(metricMemoryUsage); got != 0 {
+		t.Errorf("escalated after recovery = %d, want 0", got)
+	}
+
+	// the next breach climbs the ladder from its own start
+	s.update(metricMemoryUsage, 90, rule, clock.now())
+	clock.advance(time.Minute)
+	s.update(metricMemoryUsage, 90, rule, clock.now())
+	restart := clock.now()
+	clock.advance(4 * time.Minute)
+	if since, due := s.escalate(metricMemoryUsage, rungs, clock.now()); !since.Equal(restart) || len(due) != 0 {
+		t.Errorf("escalate 4m into the next breach = %v, %v, want %v and no rung", since, due, restart)
+	}
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// statsFieldCount is the number of CSV fields, one per Stats field.
+const statsFieldCount = 7
+
+// Stats is a single sample reported by the stats endpoint. The values
+// are floats as some exporters report fractional load and usage.
+type Stats struct {
+	LoadAverage     float64 `json:"load_average"`
+	MemoryTotal     float64 `json:"memory_total"`
+	MemoryUsed      float64 `json:"memory_used"`
+	DiskTotal       float64 `json:"disk_total"`
+	DiskUsed        float64 `json:"disk_used"`
+	NetworkCapacity float64 `json:"network_capacity"`
+	NetworkUsed     float64 `json:"network_used"`
+
+	// CPUCores is optional, it is only sent in JSON bodies
+	CPUCores uint64 `json:"cpu_cores,omitempty"`
+}
+
+func (s *Stats) MemoryUsage() float64 { return percent(s.MemoryUsed, s.MemoryTotal) }
+
+func (s *Stats) DiskUsage() float64 { return percent(s.DiskUsed, s.DiskTotal) }
+
+func (s *Stats) NetworkUsage() float64 { return percent(s.NetworkUsed, s.NetworkCapacity) }
+
+// MemoryFree is the free memory, zero when the used memory is over the total.
+func (s *Stats) MemoryFree() float64 { return free(s.MemoryUsed, s.MemoryTotal) }
+
+// DiskFree is the free disk space, zero when the used space is over the total.
+func (s *Stats) DiskFree() float64 { return free(s.DiskUsed, s.DiskTotal) }
+
+// NetworkFree is the free bandwidth, zero when the used one is over the capacity.
+func (s *Stats) NetworkFree() float64 { return free(s.NetworkUsed, s.NetworkCapacity) }
+
+func free(used, total float64) float64 {
+	if used > total {
+		return 0
+	}
+	return total - used
+}
+
+func percent(used, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return (used / total) * 100.0
+}
+
+// fields returns pointers to the stats values in CSV column order.
+func (s *Stats) fields() []*float64 {
+	return []*float64{
+		&s.LoadAverage,
+		&s.MemoryTotal,
+		&s.MemoryUsed,
+		&s.DiskTotal,
+		&s.DiskUsed,
+		&s.NetworkCapacity,
+		&s.NetworkUsed,
+	}
+}
+
+// maxPrecision is the most decimals alert values are formatted with.
+const maxPrecision = 6
+
+// formatFixed formats v with the given number of decimals, truncating
+// like the integer output did rather than rounding up. The epsilon keeps
+// values like 81.3, stored as 81.29999..., from losing a digit.
+func formatFixed(v float64, decimals int) string {
+	scale := math.Pow10(decimals)
+	return strconv.FormatFloat(math.Trunc(v*scale+1e-9)/scale, 'f', decimals, 64)
+}
+
+// -units values
+const (
+	unitsMb     = "mb"
+	unitsBinary = "binary"
+	unitsSI     = "si"
+)
+
+// formatBytes formats n in the largest unit it has at least one of,
+// in powers of 1024 (KiB, MiB...) or with si in powers of 1000 (kB, MB...).
+// A value rounding up to the next unit is shown in it, 1.0 MiB rather
+// than 1024.0 KiB.
+func formatBytes(n float64, si bool) string {
+	base, units := 1024.0, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	if si {
+		base, units = 1000.0, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+	}
+
+	v, i := n, 0
+	for math.Round(v*10)/10 >= base && i < len(units)-1 {
+		v /= base
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", uint64(n))
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
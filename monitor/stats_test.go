@@ -0,0 +1,61 @@
+package monitor
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    float64
+		si   bool
+		want string
+	}{
+		{0, false, "0 B"},
+		{1000, false, "1000 B"},
+		{1023, false, "1023 B"},
+		{1024, false, "1.0 KiB"},
+		{1025, false, "1.0 KiB"},
+		{1536, false, "1.5 KiB"},
+		{1<<20 - 1, false, "1.0 MiB"},
+		{1 << 20, false, "1.0 MiB"},
+		{10 << 30, false, "10.0 GiB"},
+		{1 << 40, false, "1.0 TiB"},
+		{999, true, "999 B"},
+		{1000, true, "1.0 kB"},
+		{1001, true, "1.0 kB"},
+		{1024, true, "1.0 kB"},
+		{999_999, true, "1.0 MB"},
+		{1e6, true, "1.0 MB"},
+		{1.5e9, true, "1.5 GB"},
+		{1e12, true, "1.0 TB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n, tt.si); got != tt.want {
+			t.Errorf("formatBytes(%v, si=%v) = %q, want %q", tt.n, tt.si, got, tt.want)
+		}
+	}
+}
+
+func TestFree(t *testing.T) {
+	tests := []struct {
+		name                  string
+		stats                 Stats
+		memory, disk, network float64
+	}{
+		{"used under total", Stats{10, 100, 40, 1000, 300, 1000, 900, 0}, 60, 700, 100},
+		{"used equals total", Stats{10, 100, 100, 1000, 1000, 1000, 1000, 0}, 0, 0, 0},
+		{"used over total", Stats{10, 100, 101, 1000, 1001, 1000, 1e12, 0}, 0, 0, 0},
+		{"beyond the uint64 range", Stats{10, 0, 1, 0, 1e20, 1, 1e30, 0}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.MemoryFree(); got != tt.memory {
+				t.Errorf("MemoryFree = %v, want %v", got, tt.memory)
+			}
+			if got := tt.stats.DiskFree(); got != tt.disk {
+				t.Errorf("DiskFree = %v, want %v", got, tt.disk)
+			}
+			if got := tt.stats.NetworkFree(); got != tt.network {
+				t.Errorf("NetworkFree = %v, want %v", got, tt.network)
+			}
+		})
+	}
+}
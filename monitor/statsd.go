@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// statsdClient sends gauges in the StatsD line protocol over one UDP
+// connection kept for the process lifetime.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+}
+
+func newStatsdClient(addr, prefix string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &statsdClient{conn: conn, prefix: prefix}, nil
+}
+
+func (c *statsdClient) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// send writes the stats gauges of server in a single packet, host is
+// added to the names when it is not empty. UDP writes don't wait for
+// the receiver, so a failure is only logged.
+func (c *statsdClient) send(host string, stats *Stats) {
+	name := c.prefix
+	if host != "" {
+		name += "." + host
+	}
+
+	var b strings.Builder
+	for _, g := range []struct {
+		metric string
+		value  float64
+	}{
+		{metricLoadAverage, stats.LoadAverage},
+		{metricMemoryUsage, stats.MemoryUsage()},
+		{metricDiskUsage, stats.DiskUsage()},
+		{metricNetworkUsage, stats.NetworkUsage()},
+	} {
+		fmt.Fprintf(&b, "%s.%s:%g|g\n", name, g.metric, g.value)
+	}
+
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		slog.Warn("Unable to send StatsD metrics.", "addr", c.conn.RemoteAddr().String(), "error", err)
+	}
+}
+
+// statsdHostName turns the host of a server URL into a metric name part.
+func statsdHostName(server string) string {
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return strings.NewReplacer(".", "_", ":", "_").Replace(host)
+}
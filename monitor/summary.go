@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// runSummary counts the poll outcomes and breaches of the whole run,
+// it is shared by the pollers.
+type runSummary struct {
+	mu            sync.Mutex
+	polls         int
+	succeeded     int
+	fetchFailures int
+	parseFailures int
+	breaches      map[string]int
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{breaches: make(map[string]int)}
+}
+
+// poll results of the polls counter
+const (
+	pollSuccess      = "success"
+	pollFetchFailure = "fetch_failure"
+	pollParseFailure = "parse_failure"
+)
+
+// recordPoll counts the poll in the summary and the polls counter.
+func (s *runSummary) recordPoll(server string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.polls++
+	result := pollFetchFailure
+	switch {
+	case err == nil:
+		s.succeeded++
+		result = pollSuccess
+	case isParseError(err):
+		s.parseFailures++
+		result = pollParseFailure
+	default:
+		s.fetchFailures++
+	}
+	pollsCounter.WithLabelValues(server, result).Inc()
+}
+
+func (s *runSummary) recordBreach(metric string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breaches[metric]++
+}
+
+func (s *runSummary) log() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the messages carry the counts, the text log prints them bare
+	ctx := bare(context.Background())
+	slog.InfoContext(ctx, fmt.Sprintf("Polls: %d total, %d succeeded, %d failed fetches, %d unparsable.",
+		s.polls, s.succeeded, s.fetchFailures, s.parseFailures),
+		"polls", s.polls, "succeeded", s.succeeded, "fetch_failures", s.fetchFailures, "parse_failures", s.parseFailures)
+	for _, metric := range sortedKeys(s.breaches) {
+		slog.InfoContext(ctx, fmt.Sprintf("Threshold breaches of %s: %d.", metric, s.breaches[metric]),
+			"metric", metric, "breaches", s.breaches[metric])
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+)
+
+// syslogNotifier sends alerts to a remote syslog daemon, critical ones
+// at the crit level, warnings at warning and recoveries at info.
+type syslogNotifier struct {
+	w *syslog.Writer
+}
+
+func newSyslogNotifier(network, addr string) (*syslogNotifier, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_WARNING, syslogTag)
+	if err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+	return &syslogNotifier{w: w}, nil
+}
+
+func (n *syslogNotifier) Notify(_ context.Context, a Alert) error {
+	switch {
+	case a.Recovered:
+		return n.w.Info(a.Message)
+	case a.Severity == severityWarning:
+		return n.w.Warning(a.Message)
+	default:
+		return n.w.Crit(a.Message)
+	}
+}
+
+func (n *syslogNotifier) Close() error {
+	return n.w.Close()
+}
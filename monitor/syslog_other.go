@@ -0,0 +1,20 @@
+//go:build windows || plan9
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// syslogNotifier is a stub, log/syslog is not implemented on this platform.
+type syslogNotifier struct{}
+
+func newSyslogNotifier(_, _ string) (*syslogNotifier, error) {
+	return nil, fmt.Errorf("syslog: not supported on %s, unset syslog-addr", runtime.GOOS)
+}
+
+func (n *syslogNotifier) Notify(context.Context, Alert) error { return nil }
+
+func (n *syslogNotifier) Close() error { return nil }
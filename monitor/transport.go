@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// newTransport builds the transport used for stats requests.
+func newTransport(cfg *Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca-file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid ca-file %s: no PEM certificates found", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsCfg
+
+	// the cloned transport reads proxy settings from the environment,
+	// an explicit proxy replaces them
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if len(cfg.Resolve) > 0 {
+		resolves, err := parseResolves(cfg.Resolve)
+		if err != nil {
+			return nil, err
+		}
+		t.DialContext = resolves.dialContext(t.DialContext)
+	}
+
+	return t, nil
+}
+
+// resolveKey is the host, and the port unless the mapping is for any.
+type resolveKey struct {
+	host string
+	port string
+}
+
+// resolveMap maps hosts to the addresses they are dialed at.
+type resolveMap map[resolveKey]string
+
+// parseResolves parses "host:ip" and "host:port:ip" mappings, an IPv6
+// address may be in brackets.
+func parseResolves(values []string) (resolveMap, error) {
+	m := make(resolveMap)
+	for _, v := range values {
+		host, rest, ok := strings.Cut(v, ":")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid resolve %q: must be host:ip or host:port:ip", v)
+		}
+		key := resolveKey{host: strings.ToLower(host)}
+		ip := net.ParseIP(strings.Trim(rest, "[]"))
+		// an IPv6 address also has colons, so the port is only split off
+		// when the rest isn't an address
+		if port, addr, ok := strings.Cut(rest, ":"); ip == nil && ok && port != "" && strings.Trim(port, "0123456789") == "" {
+			key.port, rest = port, addr
+			ip = net.ParseIP(strings.Trim(addr, "[]"))
+		}
+		if ip == nil {
+			return nil, fmt.Errorf("invalid resolve %q: %q is not an IP address", v, rest)
+		}
+		m[key] = ip.String()
+	}
+	return m, nil
+}
+
+// dialContext dials the mapped hosts at their address and the others
+// with dial. Only the dialed address changes, so the TLS server name and
+// the Host header still come from the URL.
+func (m resolveMap) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			host = strings.ToLower(host)
+			ip, ok := m[resolveKey{host, port}]
+			if !ok {
+				ip, ok = m[resolveKey{host: host}]
+			}
+			if ok {
+				slog.Debug("Dialing resolved host.", "host", host, "ip", ip)
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// checkRedirect follows up to max redirects of a stats request and logs
+// every hop. With max 0 the 3xx response is returned as it is and fails
+// the poll as a bad status.
+func checkRedirect(max int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if max == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > max {
+			return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, max)
+		}
+		slog.Debug("Following redirect.", "from", via[len(via)-1].URL.String(), "to", req.URL.String(), "hop", len(via))
+		return nil
+	}
+}
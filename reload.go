@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"stat_loader/monitor"
+)
+
+// reloadOnSIGHUP re-reads the configuration on every SIGHUP and swaps
+// the active one, an invalid configuration keeps the previous in force.
+func reloadOnSIGHUP(ctx context.Context, m *monitor.Monitor) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		cfg, err := monitor.LoadConfig(os.Args[1:])
+		if err != nil {
+			slog.Error("Unable to reload config, keeping the previous one.", "error", err)
+			continue
+		}
+		ignored, err := m.Reload(cfg)
+		if err != nil {
+			slog.Error("Unable to reload config, keeping the previous one.", "error", err)
+			continue
+		}
+		if len(ignored) > 0 {
+			slog.Warn("Config changes require a restart and were ignored.", "settings", ignored)
+		}
+		slog.Info("Config reloaded.")
+	}
+}